@@ -0,0 +1,196 @@
+package sshtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// adminExecMock is a body of exec mock request, delay is a duration string like "100ms"
+type adminExecMock struct {
+	Command    string `json:"command"`
+	Stdout     string `json:"stdout"`
+	Stderr     string `json:"stderr"`
+	ExitStatus uint32 `json:"exit_status"`
+	Delay      string `json:"delay"`
+}
+
+// adminKey is a body of authorized key request, key is in authorized_keys format.
+// Key is authorized for any user if user is empty.
+type adminKey struct {
+	User string `json:"user"`
+	Key  string `json:"key"`
+}
+
+// AdminHandler returns http handler of admin API:
+//
+//	GET    /connections              served connections with channels and events, see ConnectionLog
+//	GET    /log.jsonl                events of served connections in JSON Lines format, see EventLine
+//	POST   /connections/{id}/kick    close connection
+//	POST   /mocks/exec               add exec mock {"command", "stdout", "stderr", "exit_status", "delay"}
+//	DELETE /mocks/exec?command=...   remove exec mock
+//	DELETE /mocks/subsystem?name=... remove subsystem mock
+//	POST   /keys                     add authorized key {"user", "key"}
+//	DELETE /keys                     remove authorized key {"user", "key"}
+//	POST   /reset                    forget served connections, remove mocks and faults
+//	GET    /metrics                  server metrics in Prometheus text format
+func (s *Server) AdminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /connections", s.adminConnections)
+	mux.HandleFunc("GET /log.jsonl", s.adminLog)
+	mux.HandleFunc("POST /connections/{id}/kick", s.adminKick)
+	mux.HandleFunc("POST /mocks/exec", s.adminAddExecMock)
+	mux.HandleFunc("DELETE /mocks/exec", s.adminRemoveExecMock)
+	mux.HandleFunc("DELETE /mocks/subsystem", s.adminRemoveSubsystemMock)
+	mux.HandleFunc("POST /keys", s.adminAddKey)
+	mux.HandleFunc("DELETE /keys", s.adminRemoveKey)
+	mux.HandleFunc("POST /reset", s.adminReset)
+	mux.Handle("GET /metrics", s.MetricsHandler())
+	return mux
+}
+
+// StartAdmin starts admin API on tcp address or on unix socket if addr is "unix:/path/to/socket".
+// Admin API is stopped with server.
+func (s *Server) StartAdmin(addr string) (net.Addr, error) {
+	listener, err := listen(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	adminServer := &http.Server{Handler: s.AdminHandler()}
+	s.mu.Lock()
+	s.adminServers = append(s.adminServers, adminServer)
+	s.mu.Unlock()
+
+	go func() {
+		if err := adminServer.Serve(listener); err != nil && err != http.ErrServerClosed {
+			s.getLogger().Warn("admin API failed", "admin", listener.Addr().String(), "error", err)
+		}
+	}()
+	s.getLogger().Info("admin API started", "admin", listener.Addr().String())
+	return listener.Addr(), nil
+}
+
+func (s *Server) stopAdmin() {
+	s.mu.Lock()
+	adminServers := s.adminServers
+	s.adminServers = nil
+	s.mu.Unlock()
+	for _, adminServer := range adminServers {
+		_ = adminServer.Close()
+	}
+}
+
+func (s *Server) writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		s.getLogger().Warn("could not write admin API response", "error", err)
+	}
+}
+
+func (s *Server) adminConnections(w http.ResponseWriter, r *http.Request) {
+	s.writeJSON(w, s.Export())
+}
+
+func (s *Server) adminLog(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/jsonl")
+	if err := s.WriteJSONL(w); err != nil {
+		s.getLogger().Warn("could not write admin API response", "error", err)
+	}
+}
+
+func (s *Server) adminKick(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("wrong connection id: %s", err), http.StatusBadRequest)
+		return
+	}
+	c, ok := s.Connection(id)
+	if !ok {
+		http.Error(w, fmt.Sprintf("connection %d not found", id), http.StatusNotFound)
+		return
+	}
+	c.logger.Debug("admin API kicks connection")
+	_ = c.Close()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) adminAddExecMock(w http.ResponseWriter, r *http.Request) {
+	mock := adminExecMock{}
+	if err := json.NewDecoder(r.Body).Decode(&mock); err != nil {
+		http.Error(w, fmt.Sprintf("wrong exec mock: %s", err), http.StatusBadRequest)
+		return
+	}
+	result := ExecResult{Stdout: mock.Stdout, Stderr: mock.Stderr, ExitStatus: mock.ExitStatus}
+	if mock.Delay != "" {
+		delay, err := time.ParseDuration(mock.Delay)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("wrong exec mock delay: %s", err), http.StatusBadRequest)
+			return
+		}
+		result.Delay = delay
+	}
+	s.MockExec(mock.Command, result)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) adminRemoveExecMock(w http.ResponseWriter, r *http.Request) {
+	s.RemoveExecMock(r.URL.Query().Get("command"))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) adminRemoveSubsystemMock(w http.ResponseWriter, r *http.Request) {
+	s.RemoveSubsystemMock(r.URL.Query().Get("name"))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) adminAddKey(w http.ResponseWriter, r *http.Request) {
+	body, key, ok := readAdminKey(w, r)
+	if !ok {
+		return
+	}
+	if body.User == "" {
+		s.AddAuthorizedKey(key)
+	} else {
+		s.AddUserAuthorizedKey(body.User, key)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) adminRemoveKey(w http.ResponseWriter, r *http.Request) {
+	body, key, ok := readAdminKey(w, r)
+	if !ok {
+		return
+	}
+	if body.User == "" {
+		s.RemoveAuthorizedKey(key)
+	} else {
+		s.RemoveUserAuthorizedKey(body.User, key)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// readAdminKey decodes key request, error response is written if it's wrong
+func readAdminKey(w http.ResponseWriter, r *http.Request) (adminKey, ssh.PublicKey, bool) {
+	body := adminKey{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, fmt.Sprintf("wrong key request: %s", err), http.StatusBadRequest)
+		return body, nil, false
+	}
+	key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(body.Key))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("wrong authorized key: %s", err), http.StatusBadRequest)
+		return body, nil, false
+	}
+	return body, key, true
+}
+
+func (s *Server) adminReset(w http.ResponseWriter, r *http.Request) {
+	s.Reset()
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,102 @@
+package sshtest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestServer_StartAdmin(t *testing.T) {
+	server := NewMockedServer()
+	host, port, err := server.Start()
+	require.NoError(t, err)
+
+	socket := filepath.Join(t.TempDir(), "admin.sock")
+	_, err = server.StartAdmin("unix:" + socket)
+	require.NoError(t, err)
+	admin := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+		},
+	}}
+	call := func(method, path, body string) *http.Response {
+		req, err := http.NewRequest(method, "http://admin"+path, strings.NewReader(body))
+		require.NoError(t, err)
+		resp, err := admin.Do(req)
+		require.NoError(t, err)
+		return resp
+	}
+
+	// authorize client and mock command
+	privateKey, publicKey := NewSSHKeyPair(2048)
+	signer, _ := ssh.NewSignerFromKey(privateKey)
+	key, _ := json.Marshal(adminKey{User: "user1", Key: string(ssh.MarshalAuthorizedKey(publicKey))})
+	require.Equal(t, http.StatusNoContent, call("POST", "/keys", string(key)).StatusCode)
+	require.Equal(t, http.StatusBadRequest, call("POST", "/keys", `{"key": "wrong"}`).StatusCode)
+	require.Equal(t, http.StatusNoContent, call("POST", "/mocks/exec", `{"command": "hostname", "stdout": "web1\n", "delay": "1ms"}`).StatusCode)
+	require.Equal(t, http.StatusBadRequest, call("POST", "/mocks/exec", `{"command": "hostname", "delay": "1 day"}`).StatusCode)
+
+	client := NewTestClient()
+	client.Auth = []ssh.AuthMethod{ssh.PublicKeys(signer)}
+	clientConn, err := ssh.Dial("tcp", fmt.Sprintf("%s:%d", host, port), client.ClientConfig)
+	require.NoError(t, err)
+	session, err := clientConn.NewSession()
+	require.NoError(t, err)
+	output, err := session.Output("hostname")
+	require.NoError(t, err)
+	require.Equal(t, "web1\n", string(output))
+
+	resp := call("GET", "/connections", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var connections []ConnectionLog
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&connections))
+	require.Len(t, connections, 1)
+	require.Equal(t, 1, connections[0].ID)
+	require.Equal(t, "user1", connections[0].User)
+	require.Equal(t, client.ClientVersion, connections[0].ClientVersion)
+	require.Len(t, connections[0].Channels, 1)
+	require.Equal(t, "exec", connections[0].Channels[0].Events[0].Name)
+	require.Equal(t, map[string]interface{}{"command": "hostname"}, connections[0].Channels[0].Events[0].Message)
+
+	resp = call("GET", "/log.jsonl", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var line EventLine
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&line))
+	require.Equal(t, 1, line.Connection)
+	require.Equal(t, "exec", line.Name)
+
+	// kick client
+	require.Equal(t, http.StatusNotFound, call("POST", "/connections/2/kick", "").StatusCode)
+	require.Equal(t, http.StatusNoContent, call("POST", "/connections/1/kick", "").StatusCode)
+	require.Error(t, clientConn.Wait())
+
+	require.Equal(t, http.StatusNoContent, call("DELETE", "/mocks/exec?command=hostname", "").StatusCode)
+	_, ok := server.getExecResult("hostname")
+	require.False(t, ok)
+
+	server.MockSubsystem("netconf", ExecResult{Stdout: "<hello/>"})
+	require.Equal(t, http.StatusNoContent, call("DELETE", "/mocks/subsystem?name=netconf", "").StatusCode)
+	_, ok = server.getSubsystemResult("netconf")
+	require.False(t, ok)
+
+	require.Equal(t, http.StatusNoContent, call("DELETE", "/keys", string(key)).StatusCode)
+	_, err = ssh.Dial("tcp", fmt.Sprintf("%s:%d", host, port), client.ClientConfig)
+	require.Error(t, err)
+	require.Equal(t, http.StatusBadRequest, call("DELETE", "/keys", `{"key": "wrong"}`).StatusCode)
+
+	require.Equal(t, http.StatusNoContent, call("POST", "/reset", "").StatusCode)
+	require.Empty(t, server.ServedConnections())
+
+	server.Stop()
+	server.Wait()
+	_, err = admin.Get("http://admin/connections")
+	require.Error(t, err)
+}
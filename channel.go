@@ -1,6 +1,8 @@
 package sshtest
 
 import (
+	"io"
+	"log/slog"
 	"sync"
 	"time"
 
@@ -14,27 +16,99 @@ func NewChannel(channel ssh.NewChannel, mockData *MockData) *Channel {
 		Type:       channel.ChannelType(),
 		newChannel: channel,
 		mockData:   mockData,
+		logger:     defaultLogger,
+		input:      newFlowReader(mockData.getFlowControl()),
+		stdin:      newStdinRecorder(nil, mockData.getStdinOptions()),
 		mu:         sync.Mutex{},
 	}
 }
 
 type Channel struct {
 	ssh.Channel
+	// sequence number of channel in connection, starting from 1
+	ID         int
 	Type       string
 	newChannel ssh.NewChannel
 	mockData   *MockData
+	conn       *Connection
+	logger     *slog.Logger
+	input      *flowReader
+	stdin      *stdinRecorder
 
-	mu       sync.Mutex
-	requests []interface{}
+	mu         sync.Mutex
+	requests   []interface{}
+	transcript []TranscriptEvent
+	pty        *protocol.MsgRequestPTY
+	openTime   time.Time
+	closeTime  time.Time
+	recordings []string
 }
 
+// ChannelStat is a statistics of channel
 type ChannelStat struct {
+	OpenTime time.Time
+	// zero if channel is not closed yet
+	CloseTime time.Time
+
+	// count of client requests per request type
+	Requests map[string]int
+
+	// bytes of client data and of stdout and stderr sent to client
+	BytesIn  int64
+	BytesOut int64
+
+	// exit status sent to client, -1 if it was not sent
+	ExitStatus int
+	// exit signal sent to client
+	ExitSignal string
+
+	// "closed by client" or "closed by server", empty if channel is not closed yet
+	CloseReason string
+}
+
+// Stat returns statistics of channel
+func (ch *Channel) Stat() ChannelStat {
+	ch.mu.Lock()
+	stat := ChannelStat{
+		OpenTime:   ch.openTime,
+		CloseTime:  ch.closeTime,
+		Requests:   map[string]int{},
+		ExitStatus: -1,
+	}
+	ch.mu.Unlock()
+	stat.BytesIn = ch.StdinSize()
+	for _, e := range ch.Transcript() {
+		switch e.Type {
+		case TranscriptRequest:
+			if e.Direction == DirectionIn {
+				stat.Requests[e.Name]++
+			}
+		case TranscriptStdout, TranscriptStderr:
+			stat.BytesOut += int64(e.Size)
+		case TranscriptExitStatus:
+			if msg, ok := e.Request.(*protocol.MsgExitStatus); ok {
+				stat.ExitStatus = int(msg.ExitStatus)
+			}
+		case TranscriptExitSignal:
+			if msg, ok := e.Request.(*protocol.MsgExitSignal); ok {
+				stat.ExitSignal = msg.Signal
+			}
+		case TranscriptClose:
+			if stat.CloseReason == "" && e.Direction == DirectionIn {
+				stat.CloseReason = "closed by client"
+			} else if stat.CloseReason == "" {
+				stat.CloseReason = "closed by server"
+			}
+		}
+	}
+	return stat
 }
 
-func (s *Channel) appendRequest(msg interface{}) {
+func (s *Channel) appendRequest(name string, msg interface{}) {
 	s.mu.Lock()
 	s.requests = append(s.requests, msg)
 	s.mu.Unlock()
+	s.record(DirectionIn, TranscriptRequest, name, msg, nil, 0)
 }
 
 func (s *Channel) Requests() []interface{} {
@@ -43,93 +117,387 @@ func (s *Channel) Requests() []interface{} {
 	return append([]interface{}{}, s.requests...)
 }
 
+func (s *Channel) getPTY() *protocol.MsgRequestPTY {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pty
+}
+
+func (ch *Channel) user() string {
+	if ch.conn == nil {
+		return ""
+	}
+	return ch.conn.User()
+}
+
+// SetFlowControl changes how client data is read from the channel
+func (ch *Channel) SetFlowControl(fc FlowControl) {
+	ch.input.setFlowControl(fc)
+}
+
+// FlowControl returns current flow control settings of the channel
+func (ch *Channel) FlowControl() FlowControl {
+	return ch.input.getFlowControl()
+}
+
+// PauseReading stops reading client data, so channel window is not adjusted
+func (ch *Channel) PauseReading() {
+	ch.input.pause(true)
+}
+
+// ResumeReading resumes reading client data stopped by PauseReading or FlowControl.StopAfter
+func (ch *Channel) ResumeReading() {
+	ch.input.pause(false)
+}
+
+// Stdin returns data received from client
+func (ch *Channel) Stdin() []byte {
+	return ch.stdin.bytes()
+}
+
+// StdinSize returns count of bytes received from client, including dropped by StdinOptions limits
+func (ch *Channel) StdinSize() int64 {
+	ch.stdin.mu.Lock()
+	defer ch.stdin.mu.Unlock()
+	return ch.stdin.size
+}
+
+// StdinTruncated reports if received data exceeding StdinOptions.MaxMemory was dropped
+func (ch *Channel) StdinTruncated() bool {
+	ch.stdin.mu.Lock()
+	defer ch.stdin.mu.Unlock()
+	return ch.stdin.truncated
+}
+
+// StdinFile returns path of file with received data if it was spilled to disk
+func (ch *Channel) StdinFile() string {
+	ch.stdin.mu.Lock()
+	defer ch.stdin.mu.Unlock()
+	if ch.stdin.file == nil {
+		return ""
+	}
+	return ch.stdin.file.Name()
+}
+
+// StdinEOFTime returns time when client closed stdin, zero time if it is still open
+func (ch *Channel) StdinEOFTime() time.Time {
+	ch.stdin.mu.Lock()
+	defer ch.stdin.mu.Unlock()
+	return ch.stdin.eofTime
+}
+
+// CloseTime returns time when channel was closed, zero time if it is still open
+func (ch *Channel) CloseTime() time.Time {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	return ch.closeTime
+}
+
+func (ch *Channel) setClosed(direction Direction) {
+	ch.mu.Lock()
+	closed := !ch.closeTime.IsZero()
+	if !closed {
+		ch.closeTime = time.Now()
+	}
+	ch.mu.Unlock()
+	if !closed {
+		ch.record(direction, TranscriptClose, "", nil, nil, 0)
+	}
+}
+
+// Close closes the channel and stops reading client data
+func (ch *Channel) Close() error {
+	ch.setClosed(DirectionOut)
+	ch.input.close()
+	return ch.Channel.Close()
+}
+
+// consumeInput reads client data till EOF, returned channel is closed when EOF is received
+func (ch *Channel) consumeInput() <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		_, _ = io.Copy(io.Discard, ch.input)
+		close(done)
+	}()
+	return done
+}
+
 func (ch *Channel) handle() {
 	channel, requests, err := ch.newChannel.Accept()
 	if err != nil {
-		debugf("could not accept channel: %v", err)
+		ch.logger.Warn("could not accept channel", "error", err)
 		return
 	}
 	ch.Channel = channel
+	ch.getMetrics().channelOpened()
+	ch.mu.Lock()
+	ch.openTime = time.Now()
+	ch.mu.Unlock()
+	ch.stdin.r = channel
+	ch.stdin.logger = ch.logger
+	ch.stdin.onRead = func(kept []byte, size int, eof bool) {
+		if eof {
+			ch.record(DirectionIn, TranscriptEOF, "", nil, nil, 0)
+			return
+		}
+		ch.record(DirectionIn, TranscriptStdin, "", nil, kept, size)
+	}
+	ch.input.setReader(ch.stdin)
+	ch.getEvents().channelOpen(ch)
 
 	ch.handleRequests(requests)
+	ch.setClosed(DirectionIn)
+	ch.input.close()
+	ch.stdin.close()
+	ch.saveRecordings(ch.mockData.getRecordingOptions())
+	ch.getMetrics().channelClosed()
+	ch.getEvents().channelClose(ch)
 }
 
-func sendReplyTrue(chType string, request *ssh.Request) {
+func (ch *Channel) getEvents() *events {
+	if ch.conn == nil {
+		return nil
+	}
+	return ch.conn.events
+}
+
+func (ch *Channel) getMetrics() *metrics {
+	if ch.conn == nil {
+		return nil
+	}
+	return ch.conn.metrics
+}
+
+// requestMessages creates messages of known channel requests
+var requestMessages = map[string]func() interface{}{
+	protocol.MsgTypePTYReq:          func() interface{} { return new(protocol.MsgRequestPTY) },
+	protocol.MsgTypePTYWindowChange: func() interface{} { return new(protocol.MsgRequestPTYWindowChange) },
+	protocol.MsgTypeEnv:             func() interface{} { return new(protocol.MsgRequestSetEnv) },
+	protocol.MsgTypeExec:            func() interface{} { return new(protocol.MsgRequestExec) },
+	protocol.MsgTypeSubsystem:       func() interface{} { return new(protocol.MsgRequestSubsystem) },
+}
+
+// parseRequest returns parsed message of known request or protocol.MsgUnparsed
+func parseRequest(request *ssh.Request) interface{} {
+	// ssh.Unmarshal does not support empty messages
+	switch request.Type {
+	case protocol.MsgTypeShell:
+		return new(protocol.MsgRequestShell)
+	case protocol.MsgTypeAuthAgent:
+		return new(protocol.MsgRequestAuthAgent)
+	}
+	if newMsg, ok := requestMessages[request.Type]; ok {
+		msg := newMsg()
+		if err := ssh.Unmarshal(request.Payload, msg); err == nil {
+			return msg
+		}
+	}
+	return protocol.NewUnparsedMsg(request.Type, request.Payload)
+}
+
+func (ch *Channel) sendReplyTrue(request *ssh.Request) {
 	if request.WantReply {
 		_ = request.Reply(true, nil)
-		debugf("channel '%s' msg '%s' replied '%v' payload: '%v'", chType, request.Type, true, request.Payload)
+		ch.logger.Debug("request replied", "request", request.Type, "reply", true)
 	}
 }
 
-func sendReplyFalse(chType string, request *ssh.Request) {
+func (ch *Channel) sendReplyFalse(request *ssh.Request) {
 	if request.WantReply {
 		_ = request.Reply(false, nil)
-		debugf("channel '%s' msg '%s' replied '%v' payload: '%v'", chType, request.Type, false, request.Payload)
+		ch.logger.Debug("request replied", "request", request.Type, "reply", false)
 	}
 }
 
+// runExec sends expected or mocked result of command and closes the channel
+func (ch *Channel) runExec(command string, expected *mockedExecResultStatus, stdinDone <-chan struct{}) {
+	defer func() {
+		_ = ch.Close()
+	}()
+	if ch.FlowControl().ExecWaitEOF {
+		<-stdinDone
+	}
+	if expected != nil {
+		ch.sendResult(*expected, stdinDone)
+		return
+	}
+	if out, ok := ch.mockData.getExecResult(command); ok {
+		ch.getMetrics().exec(execSourceMock, command)
+		ch.sendResult(out, stdinDone)
+		return
+	}
+	if out, ok := ch.mockData.getFallbackResult(command); ok {
+		ch.getMetrics().exec(execSourceFallback, command)
+		ch.sendResult(out, stdinDone)
+		return
+	}
+	ch.getMetrics().exec(execSourceUnmocked, command)
+	ch.sendResult(mockedExecResultStatus{}, stdinDone)
+}
+
+// runSubsystem sends mocked result of subsystem and closes the channel
+func (ch *Channel) runSubsystem(out mockedExecResultStatus, stdinDone <-chan struct{}) {
+	defer func() {
+		_ = ch.Close()
+	}()
+	if ch.FlowControl().ExecWaitEOF {
+		<-stdinDone
+	}
+	ch.sendResult(out, stdinDone)
+}
+
+// sendResult sends output, waits till client data is read to EOF and sends exit status
+func (ch *Channel) sendResult(out mockedExecResultStatus, stdinDone <-chan struct{}) {
+	time.Sleep(out.timeout)
+	if ch.conn != nil && ch.conn.hasFault(FaultDuringExecOutput) {
+		half := len(out.result) / 2
+		_, _ = ch.Write([]byte(out.result[:half]))
+		ch.conn.triggerFault(FaultDuringExecOutput)
+		out.result = out.result[half:]
+	}
+	_, _ = ch.Write([]byte(out.result))
+	if out.stderr != "" {
+		_, _ = ch.Stderr().Write([]byte(out.stderr))
+	}
+	// stdin is read till client closes it or the channel, so it is recorded completely
+	if !ch.FlowControl().ExecCloseEarly {
+		<-stdinDone
+	}
+	_, _ = ch.SendRequest("exit-status", false, ssh.Marshal(&protocol.MsgExitStatus{ExitStatus: out.exitStatus}))
+}
+
+// env returns environment variables requested by client
+func (ch *Channel) env() (env []*protocol.MsgRequestSetEnv) {
+	for _, r := range ch.Requests() {
+		if msg, ok := r.(*protocol.MsgRequestSetEnv); ok {
+			env = append(env, msg)
+		}
+	}
+	return
+}
+
+// rejectMalformed records request which payload can't be parsed and replies false
+func (ch *Channel) rejectMalformed(request *ssh.Request) {
+	ch.logger.Debug("malformed request", "request", request.Type)
+	ch.appendRequest(request.Type, protocol.NewUnparsedMsg(request.Type, request.Payload))
+	ch.sendReplyFalse(request)
+}
+
 func (ch *Channel) handleRequests(in <-chan *ssh.Request) {
 	for request := range in {
-		debugf("channel '%s' msg '%s' wantReply '%v' with payload: '%v'", ch.newChannel.ChannelType(), request.Type, request.WantReply, request.Payload)
+		ch.logger.Debug("request received", "request", request.Type, "want_reply", request.WantReply, "payload", request.Payload)
+		ch.getMetrics().request(request.Type)
+		if events := ch.getEvents(); events != nil {
+			msg := parseRequest(request)
+			if err := events.request(ch, request.Type, msg); err != nil {
+				ch.logger.Debug("request rejected by hook", "request", request.Type, "error", err)
+				ch.appendRequest(request.Type, msg)
+				ch.sendReplyFalse(request)
+				continue
+			}
+		}
 		var msg interface{}
+		var exec *protocol.MsgRequestExec
+		// run is started after request is recorded, so its output follows the request in transcript
+		var run func()
 		switch request.Type {
 		case protocol.MsgTypePTYReq:
 			msg = new(protocol.MsgRequestPTY)
 			if err := ssh.Unmarshal(request.Payload, msg); err != nil {
-				ch.appendRequest(protocol.NewUnparsedMsg(request.Type, request.Payload))
-				sendReplyFalse(ch.newChannel.ChannelType(), request)
+				ch.rejectMalformed(request)
+				continue
 			}
-			sendReplyTrue(ch.newChannel.ChannelType(), request)
+			ch.mu.Lock()
+			ch.pty = msg.(*protocol.MsgRequestPTY)
+			ch.mu.Unlock()
+			ch.sendReplyTrue(request)
 
 		case protocol.MsgTypePTYWindowChange:
 			msg = new(protocol.MsgRequestPTYWindowChange)
 			if err := ssh.Unmarshal(request.Payload, msg); err != nil {
-				ch.appendRequest(protocol.NewUnparsedMsg(request.Type, request.Payload))
-				sendReplyFalse(ch.newChannel.ChannelType(), request)
+				ch.rejectMalformed(request)
+				continue
 			}
-			sendReplyTrue(ch.newChannel.ChannelType(), request)
+			ch.sendReplyTrue(request)
 
 		case protocol.MsgTypeEnv:
 			msg = new(protocol.MsgRequestSetEnv)
 			if err := ssh.Unmarshal(request.Payload, msg); err != nil {
-				ch.appendRequest(protocol.NewUnparsedMsg(request.Type, request.Payload))
+				ch.rejectMalformed(request)
+				continue
 			}
-			sendReplyTrue(ch.newChannel.ChannelType(), request)
+			ch.sendReplyTrue(request)
 
 		case protocol.MsgTypeExec:
 			msg = new(protocol.MsgRequestExec)
 			if err := ssh.Unmarshal(request.Payload, msg); err != nil {
-				ch.appendRequest(protocol.NewUnparsedMsg(request.Type, request.Payload))
-				sendReplyFalse(ch.newChannel.ChannelType(), request)
+				ch.rejectMalformed(request)
+				continue
 			}
 
-			sendReplyTrue(ch.newChannel.ChannelType(), request)
-			go func(ch *Channel, msg *protocol.MsgRequestExec) {
-				defer func() {
-					_ = ch.Close()
-				}()
-				for in, out := range ch.mockData.getMocksExecResult() {
-					if in == msg.Command {
-						time.Sleep(out.timeout)
-						_, _ = ch.Write([]byte(out.result))
-						_, _ = ch.SendRequest("exit-status", false, ssh.Marshal(&protocol.MsgExitStatus{ExitStatus: out.exitStatus}))
-						return
-					}
-				}
-				_, _ = ch.SendRequest("exit-status", false, ssh.Marshal(protocol.MsgExitStatus{ExitStatus: 0}))
-			}(ch, msg.(*protocol.MsgRequestExec))
+			ch.sendReplyTrue(request)
+			exec = msg.(*protocol.MsgRequestExec)
+
+		case protocol.MsgTypeSubsystem:
+			msg = new(protocol.MsgRequestSubsystem)
+			if err := ssh.Unmarshal(request.Payload, msg); err != nil {
+				ch.rejectMalformed(request)
+				continue
+			}
+			name := msg.(*protocol.MsgRequestSubsystem).Name
+			if proxy := ch.mockData.getProxy(); proxy != nil {
+				ch.sendReplyTrue(request)
+				run = func() { ch.runProxy(proxy, protocol.MsgTypeSubsystem, name) }
+			} else if out, ok := ch.mockData.getSubsystemResult(name); ok {
+				ch.sendReplyTrue(request)
+				run = func() { ch.runSubsystem(out, ch.consumeInput()) }
+			} else {
+				ch.sendReplyFalse(request)
+			}
 
 		case protocol.MsgTypeAuthAgent:
 			msg = new(protocol.MsgRequestAuthAgent)
-			sendReplyTrue(ch.newChannel.ChannelType(), request)
+			ch.sendReplyTrue(request)
 
 		case protocol.MsgTypeShell:
 			msg = new(protocol.MsgRequestShell)
-			sendReplyTrue(ch.newChannel.ChannelType(), request)
+			ch.sendReplyTrue(request)
+			if proxy := ch.mockData.getProxy(); proxy != nil {
+				run = func() { ch.runProxy(proxy, protocol.MsgTypeShell, "") }
+			} else if p := ch.mockData.getPersonality(); p != nil {
+				run = func() { ch.runShell(p) }
+			} else {
+				ch.consumeInput()
+			}
 		default:
 			msg = protocol.NewUnparsedMsg(request.Type, request.Payload)
-			sendReplyFalse(ch.newChannel.ChannelType(), request)
+			ch.sendReplyFalse(request)
+		}
+		ch.appendRequest(request.Type, msg)
+		if run != nil {
+			go run()
+		}
+
+		var expected *mockedExecResultStatus
+		if e := ch.mockData.getExpectations(); e != nil {
+			expected = e.observe(msg)
+		}
+		if exec != nil {
+			source := execSourceExpectation
+			if result := ch.getEvents().exec(ch, exec); result != nil {
+				mocked := result.mocked()
+				expected = &mocked
+				source = execSourceHook
+			}
+			if proxy := ch.mockData.getProxy(); proxy != nil {
+				ch.getMetrics().exec(execSourceProxy, exec.Command)
+				go ch.runProxy(proxy, protocol.MsgTypeExec, exec.Command)
+			} else {
+				if expected != nil {
+					ch.getMetrics().exec(source, exec.Command)
+				}
+				go ch.runExec(exec.Command, expected, ch.consumeInput())
+			}
 		}
-		ch.appendRequest(msg)
 	}
 }
@@ -0,0 +1,176 @@
+// Command sshtest runs mocked ssh server for tests of ssh clients written in any language.
+//
+// Usage:
+//
+//	sshtest -listen localhost:2222 -scenario scenario.yaml -debug
+//
+// Served connections log is printed to stdout when the server is stopped with SIGINT or SIGTERM.
+// With -log the log is also written to JSON file, or to JSON Lines file if its name ends with ".jsonl".
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/craftyhunter/go-sshtest"
+)
+
+const defaultListen = "localhost:2222"
+
+func main() {
+	listen := flag.String("listen", "", "listen address, \"unix:/path\" for unix socket (default \""+defaultListen+"\")")
+	hostKeyFile := flag.String("host-key", "", "private host key file in PEM format, added to host keys of scenario, new key is generated if empty")
+	authorizedKeysFile := flag.String("authorized-keys", "", "authorized_keys file with keys allowed for any user")
+	scenarioFile := flag.String("scenario", "", "yaml or json scenario file")
+	adminAddr := flag.String("admin", "", "admin http API address, \"unix:/path\" for unix socket, disabled if empty")
+	logFile := flag.String("log", "", "write served connections log to json or jsonl file on stop")
+	noAuth := flag.Bool("no-auth", false, "allow clients without authentication")
+	debug := flag.Bool("debug", false, "enable debug logging")
+	flag.Parse()
+
+	level := slog.LevelWarn
+	if *debug {
+		level = slog.LevelDebug
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+
+	server, scenario, err := newServer(*listen, *hostKeyFile, *scenarioFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	sshtest.WithLogger(logger)(server)
+	if *noAuth {
+		server.NoClientAuth = true
+	}
+	if *authorizedKeysFile != "" {
+		if err = addAuthorizedKeys(server, *authorizedKeysFile); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if _, _, err = server.Start(); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("sshtest server '%s' is listening on %s", server.ServerVersion, server.Addr())
+	if *adminAddr != "" {
+		addr, err := server.StartAdmin(*adminAddr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("admin API is listening on %s", addr.String())
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	<-signals
+
+	server.Stop()
+	server.DumpTranscript(os.Stdout)
+	if *logFile != "" {
+		if err = writeLog(server, *logFile); err != nil {
+			log.Printf("could not write log: %s", err)
+		}
+	}
+
+	if scenario != nil {
+		if err = scenario.Verify(server); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+}
+
+func newServer(listen, hostKeyFile, scenarioFile string) (server *sshtest.Server, scenario *sshtest.Scenario, err error) {
+	if scenarioFile != "" {
+		if scenario, err = sshtest.ReadScenario(scenarioFile); err != nil {
+			return
+		}
+		if listen == "" {
+			listen = scenario.Listen
+		}
+	}
+	if listen == "" {
+		listen = defaultListen
+	}
+	if scenario != nil {
+		scenario.Listen = listen
+	}
+
+	if hostKeyFile != "" {
+		data, err := os.ReadFile(hostKeyFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		signer, err := ssh.ParsePrivateKey(data)
+		if err != nil {
+			return nil, nil, fmt.Errorf("wrong host key %s: %s", hostKeyFile, err)
+		}
+		if scenario != nil && len(scenario.HostKeys) > 0 {
+			// host key of the flag is served with host keys of scenario and replaces the one of the same type
+			if server, err = scenario.NewServer(); err != nil {
+				return nil, nil, err
+			}
+			server.AddHostKey(signer)
+			return server, scenario, nil
+		}
+		server = sshtest.NewServer(listen, signer)
+		if scenario != nil {
+			err = scenario.Apply(server)
+		}
+		return server, scenario, err
+	}
+
+	if scenario != nil {
+		server, err = scenario.NewServer()
+		return
+	}
+
+	signer, err := ssh.NewSignerFromKey(sshtest.NewRSAKey(2048))
+	if err != nil {
+		return
+	}
+	return sshtest.NewServer(listen, signer), nil, nil
+}
+
+func addAuthorizedKeys(server *sshtest.Server, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(line))
+		if err != nil {
+			return fmt.Errorf("wrong authorized key in %s: %s", path, err)
+		}
+		server.AddAuthorizedKey(key)
+	}
+	return nil
+}
+
+func writeLog(server *sshtest.Server, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if strings.HasSuffix(path, ".jsonl") {
+		err = server.WriteJSONL(f)
+	} else {
+		err = server.WriteJSON(f)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
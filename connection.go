@@ -1,9 +1,12 @@
 package sshtest
 
 import (
+	"fmt"
 	"io"
+	"log/slog"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/crypto/ssh"
@@ -13,26 +16,156 @@ func NewConnection(conn net.Conn, mockData *MockData) *Connection {
 	return &Connection{
 		Conn:     conn,
 		mockData: mockData,
+		logger:   defaultLogger,
+		closed:   make(chan struct{}),
 		mu:       sync.Mutex{},
 	}
 }
 
 type Connection struct {
 	net.Conn
+	// sequence number of connection accepted by server, starting from 1
+	ID         int
 	ClientConn *ssh.ServerConn
 	mockData   *MockData
 
-	mu             sync.Mutex
-	startTime      time.Time
-	stopTime       time.Time
-	servedChannels []*Channel
+	faults  *faultConn
+	network *throttledConn
+	logger  *slog.Logger
+	events  *events
+	metrics *metrics
+	// closed when connection is handled
+	closed chan struct{}
+
+	// bytes received from and sent to client
+	bytesIn  atomic.Int64
+	bytesOut atomic.Int64
+	// session channels being handled
+	activeChannels atomic.Int32
+
+	mu               sync.Mutex
+	startTime        time.Time
+	authTime         time.Time
+	stopTime         time.Time
+	closeReason      string
+	servedChannels   []*Channel
+	rejectedChannels int
 }
 
+// ConnectionStat is a statistics of connection
 type ConnectionStat struct {
+	ConnectTime time.Time
+	// zero if client is not authenticated
+	AuthTime time.Time
+	// zero if connection is not closed yet
+	DisconnectTime time.Time
+	// time from connect to successful authentication
+	HandshakeDuration time.Duration
+
+	// bytes received from and sent to client including ssh protocol overhead
+	BytesIn  int64
+	BytesOut int64
+
+	// count of accepted and rejected channels
+	Channels         int
+	RejectedChannels int
+	// count of requests of all channels per request type
+	Requests map[string]int
+
+	// "client disconnected", "closed by server", handshake or connection error
+	CloseReason string
+}
+
+// Stat returns statistics of connection
+func (c *Connection) Stat() ConnectionStat {
+	c.mu.Lock()
+	stat := ConnectionStat{
+		ConnectTime:      c.startTime,
+		AuthTime:         c.authTime,
+		DisconnectTime:   c.stopTime,
+		Channels:         len(c.servedChannels),
+		RejectedChannels: c.rejectedChannels,
+		Requests:         map[string]int{},
+		CloseReason:      c.closeReason,
+	}
+	channels := append([]*Channel{}, c.servedChannels...)
+	c.mu.Unlock()
+	if !stat.AuthTime.IsZero() {
+		stat.HandshakeDuration = stat.AuthTime.Sub(stat.ConnectTime)
+	}
+	stat.BytesIn = c.bytesIn.Load()
+	stat.BytesOut = c.bytesOut.Load()
+	for _, ch := range channels {
+		for request, count := range ch.Stat().Requests {
+			stat.Requests[request] += count
+		}
+	}
+	return stat
+}
+
+// Read counts bytes received from client
+func (c *Connection) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.bytesIn.Add(int64(n))
+	c.metrics.received(n)
+	return n, err
+}
+
+// Write counts bytes sent to client
+func (c *Connection) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.bytesOut.Add(int64(n))
+	c.metrics.sent(n)
+	return n, err
+}
+
+// Close closes connection, its close reason is "closed by server" unless connection is already closed
+func (c *Connection) Close() error {
+	c.setCloseReason("closed by server")
+	return c.Conn.Close()
+}
+
+// transportConn is a connection used by ssh library, its Close is not counted as server close
+type transportConn struct {
+	*Connection
+}
+
+func (t transportConn) Close() error {
+	return t.Conn.Close()
+}
+
+// closeIdle closes connection without active channels, it reports if connection was closed
+func (c *Connection) closeIdle(reason string) bool {
+	if c.activeChannels.Load() > 0 {
+		return false
+	}
+	c.disconnect(reason)
+	return true
+}
+
+// disconnect sends disconnect message with reason to authenticated client and closes connection
+func (c *Connection) disconnect(reason string) {
+	c.setCloseReason(reason)
+	if clientConn := c.getClientConn(); clientConn != nil {
+		if err := sendDisconnect(clientConn, reason); err != nil {
+			c.logger.Debug("could not send disconnect message", "error", err)
+		}
+	}
+	_ = c.Conn.Close()
+}
+
+// setCloseReason sets the first reason of connection close
+func (c *Connection) setCloseReason(reason string) {
+	c.mu.Lock()
+	if c.closeReason == "" {
+		c.closeReason = reason
+	}
+	c.mu.Unlock()
 }
 
 func (s *Connection) appendChannel(ch *Channel) {
 	s.mu.Lock()
+	ch.ID = len(s.servedChannels) + 1
 	s.servedChannels = append(s.servedChannels, ch)
 	s.mu.Unlock()
 }
@@ -43,24 +176,158 @@ func (s *Connection) ServedChannels() []*Channel {
 	return append([]*Channel{}, s.servedChannels...)
 }
 
+// authLog reports authentication attempt to metrics and hooks
+func (c *Connection) authLog(method string, err error) {
+	c.mu.Lock()
+	handshake := time.Since(c.startTime)
+	c.mu.Unlock()
+	c.metrics.auth(method, err, handshake)
+	c.events.auth(c, method, err)
+}
+
+func (c *Connection) rejectChannel(newChannel ssh.NewChannel) {
+	c.mu.Lock()
+	c.rejectedChannels++
+	c.mu.Unlock()
+	_ = newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+}
+
+// getClientConn returns ssh connection, it is nil until client is authenticated
+func (c *Connection) getClientConn() *ssh.ServerConn {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ClientConn
+}
+
+// User returns name of authenticated user
+func (c *Connection) User() string {
+	if clientConn := c.getClientConn(); clientConn != nil {
+		return clientConn.User()
+	}
+	return ""
+}
+
+// injectFaults wraps connection to inject faults, it must be called before handle
+func (c *Connection) injectFaults(faults []Fault) {
+	if len(faults) == 0 {
+		return
+	}
+	c.faults = newFaultConn(c.Conn, faults)
+	c.faults.logger = c.logger
+	c.Conn = c.faults
+}
+
+// SetNetworkConditions sets simulated network conditions of connection.
+// Connections accepted by Server can be changed at any time,
+// other connections must be set up before handling.
+func (c *Connection) SetNetworkConditions(conditions NetworkConditions) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.network == nil {
+		c.network = newThrottledConn(c.Conn, conditions)
+		c.Conn = c.network
+		return
+	}
+	c.network.setConditions(conditions)
+}
+
+// NetworkConditions returns simulated network conditions of connection
+func (c *Connection) NetworkConditions() NetworkConditions {
+	c.mu.Lock()
+	network := c.network
+	c.mu.Unlock()
+	if network == nil {
+		return NetworkConditions{}
+	}
+	return network.getConditions()
+}
+
+// writeChannelData writes channel data with write, FaultAfterBytes faults are injected when their limits are reached
+func (c *Connection) writeChannelData(data []byte, write func([]byte) (int, error)) (n int, err error) {
+	if c == nil || c.faults == nil {
+		return write(data)
+	}
+	for len(data) > 0 {
+		left := c.faults.bytesLeft()
+		if left == 0 {
+			c.faults.addChannelData(0)
+			continue
+		}
+		chunk := data
+		if left > 0 && int64(len(chunk)) > left {
+			chunk = data[:left]
+		}
+		var m int
+		m, err = write(chunk)
+		n += m
+		data = data[m:]
+		c.faults.addChannelData(m)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (c *Connection) triggerFault(point FaultPoint) {
+	if c.faults != nil {
+		c.faults.trigger(point)
+	}
+}
+
+func (c *Connection) hasFault(point FaultPoint) bool {
+	return c.faults != nil && c.faults.hasFault(point)
+}
+
 func (c *Connection) handle(serverConfig *ssh.ServerConfig) {
+	c.mu.Lock()
 	c.startTime = time.Now()
+	c.mu.Unlock()
+	c.metrics.connectionOpened()
 	defer func() {
 		_ = c.Close()
-		debugf("connection from '%s' closed", c.Conn.RemoteAddr().String())
-
+		c.mu.Lock()
+		if c.stopTime.IsZero() {
+			c.stopTime = time.Now()
+		}
+		c.mu.Unlock()
+		c.logger.Debug("connection closed")
+		c.metrics.connectionClosed()
+		c.events.disconnect(c)
+		close(c.closed)
 	}()
+	if err := c.events.connect(c); err != nil {
+		c.logger.Debug("connection rejected by hook", "error", err)
+		c.setCloseReason("rejected by hook: " + err.Error())
+		return
+	}
+	c.triggerFault(FaultOnConnect)
 
-	clientConn, channels, reqs, err := ssh.NewServerConn(c, serverConfig)
+	config := *serverConfig
+	next := serverConfig.AuthLogCallback
+	config.AuthLogCallback = func(meta ssh.ConnMetadata, method string, err error) {
+		if next != nil {
+			next(meta, method, err)
+		}
+		c.authLog(method, err)
+	}
+	serverConfig = &config
+	clientConn, channels, reqs, err := ssh.NewServerConn(transportConn{c}, serverConfig)
 	if err != nil {
 		if err != io.EOF {
-			debugf("failed to handshake: %s", err)
+			c.logger.Warn("failed to handshake", "error", err)
+			c.setCloseReason("handshake failed: " + err.Error())
 			return
 		}
+		c.setCloseReason("client disconnected during handshake")
 		return
 	}
-	debugf("client '%s' connected from %s", clientConn.ClientVersion(), c.RemoteAddr().String())
+	c.logger.Debug("client connected", "client_version", string(clientConn.ClientVersion()), "user", clientConn.User())
+	c.mu.Lock()
 	c.ClientConn = clientConn
+	c.authTime = time.Now()
+	c.mu.Unlock()
+	c.triggerFault(FaultAfterAuth)
 
 	var wg sync.WaitGroup
 	// The incoming Request channel must be serviced.
@@ -71,30 +338,41 @@ func (c *Connection) handle(serverConfig *ssh.ServerConfig) {
 	}()
 
 	for newChannel := range channels {
-		debugf("channel '%s' accepted", newChannel.ChannelType())
 		switch newChannel.ChannelType() {
 		case "session":
 			ch1 := NewChannel(newChannel, c.mockData)
+			ch1.conn = c
 			c.appendChannel(ch1)
+			ch1.logger = c.logger.With("channel", ch1.ID)
+			ch1.logger.Debug("channel accepted", "channel_type", ch1.Type)
+			c.activeChannels.Add(1)
 			wg.Add(1)
 			go func() {
 				ch1.handle()
+				c.activeChannels.Add(-1)
 				wg.Done()
 			}()
-		case "auth-agent@openssh.com":
-			_ = newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
 		default:
-			_ = newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+			c.logger.Debug("channel rejected", "channel_type", newChannel.ChannelType())
+			c.rejectChannel(newChannel)
 		}
 	}
 	wg.Wait()
+	if err := clientConn.Wait(); err == nil || err == io.EOF {
+		c.setCloseReason("client disconnected")
+	} else {
+		c.setCloseReason(err.Error())
+	}
 
+	c.mu.Lock()
 	c.stopTime = time.Now()
-	debugf("client from '%s' disconnected. Duration: %s", c.Conn.RemoteAddr().String(), c.stopTime.Sub(c.startTime).String())
+	duration := c.stopTime.Sub(c.startTime)
+	c.mu.Unlock()
+	c.logger.Debug("client disconnected", "duration", duration)
 
 	for _, ch := range c.ServedChannels() {
 		for _, r := range ch.Requests() {
-			debugf("accepted request: %[1]T %[1]v", r)
+			ch.logger.Debug("accepted request", "request", fmt.Sprintf("%T %+v", r, r))
 		}
 	}
 }
@@ -1,25 +1,66 @@
 package sshtest
 
-import "log"
+import (
+	"context"
+	"log"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+)
 
-var debugEnabled bool
+var debugEnabled atomic.Bool
 
+// DebugOn enables output of default logger to standard log
 func DebugOn() {
-	debugEnabled = true
+	debugEnabled.Store(true)
 }
 
+// DebugOff disables output of default logger
 func DebugOff() {
-	debugEnabled = false
+	debugEnabled.Store(false)
 }
 
-func debug(v ...interface{}) {
-	if debugEnabled {
-		log.Print(v...)
-	}
+// defaultLogger is used by servers without logger, it writes to standard log when debug is enabled
+var defaultLogger = slog.New(debugHandler{slog.NewTextHandler(logfWriter(log.Printf), &slog.HandlerOptions{
+	Level: slog.LevelDebug,
+	ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+		// standard log writes time itself
+		if len(groups) == 0 && a.Key == slog.TimeKey {
+			return slog.Attr{}
+		}
+		return a
+	},
+})})
+
+// debugHandler passes records to handler only when debug is enabled
+type debugHandler struct {
+	slog.Handler
+}
+
+func (h debugHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return debugEnabled.Load() && h.Handler.Enabled(ctx, level)
 }
 
-func debugf(format string, v ...interface{}) {
-	if debugEnabled {
-		log.Printf(format, v...)
-	}
+func (h debugHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return debugHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h debugHandler) WithGroup(name string) slog.Handler {
+	return debugHandler{h.Handler.WithGroup(name)}
+}
+
+// Logf is a printf-like function of debug output, for example testing.T.Logf
+type Logf func(format string, v ...interface{})
+
+// NewLogfLogger returns logger writing records of all levels to logf in text format
+func NewLogfLogger(logf Logf) *slog.Logger {
+	return slog.New(slog.NewTextHandler(logfWriter(logf), &slog.HandlerOptions{Level: slog.LevelDebug}))
+}
+
+// logfWriter writes each line of text handler with logf
+type logfWriter Logf
+
+func (w logfWriter) Write(p []byte) (int, error) {
+	w("%s", strings.TrimSuffix(string(p), "\n"))
+	return len(p), nil
 }
@@ -1,19 +1,74 @@
 package sshtest
 
 import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
 )
 
 func TestDebugOn(t *testing.T) {
-	debugEnabled = false
+	debugEnabled.Store(false)
 	DebugOn()
-	require.Equal(t, true, debugEnabled)
+	require.Equal(t, true, debugEnabled.Load())
 }
 
 func TestDebugOff(t *testing.T) {
-	debugEnabled = true
+	debugEnabled.Store(true)
 	DebugOff()
-	require.Equal(t, false, debugEnabled)
+	require.Equal(t, false, debugEnabled.Load())
+}
+
+func TestWithLogger(t *testing.T) {
+	buf := new(bytes.Buffer)
+	var mu sync.Mutex
+	logger := slog.New(slog.NewJSONHandler(&lockedWriter{w: buf, mu: &mu}, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	server := NewMockedServer()
+	WithLogger(logger)(server)
+	server.NoClientAuth = true
+	_, _, err := server.Start()
+	require.NoError(t, err)
+
+	client := NewTestClient()
+	clientConn, err := ssh.Dial("tcp", server.Addr(), client.ClientConfig)
+	require.NoError(t, err)
+	session, err := clientConn.NewSession()
+	require.NoError(t, err)
+	require.NoError(t, session.Run("whoami"))
+	_ = clientConn.Close()
+	server.Stop()
+	server.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	found := false
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		record := map[string]interface{}{}
+		require.NoError(t, json.Unmarshal([]byte(line), &record))
+		require.Equal(t, server.Addr(), record["server"])
+		if record["msg"] == "request received" && record["request"] == "exec" {
+			require.Equal(t, "DEBUG", record["level"])
+			require.Equal(t, float64(1), record["conn"])
+			require.Equal(t, float64(1), record["channel"])
+			found = true
+		}
+	}
+	require.True(t, found)
+}
+
+type lockedWriter struct {
+	w  io.Writer
+	mu *sync.Mutex
+}
+
+func (w *lockedWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.w.Write(p)
 }
@@ -0,0 +1,50 @@
+package sshtest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// HostKeyCallback returns callback accepting host keys of server only
+func (s *Server) HostKeyCallback() ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		for _, k := range s.HostKeys() {
+			if bytes.Equal(k.Marshal(), key.Marshal()) {
+				return nil
+			}
+		}
+		return fmt.Errorf("unknown host key %s", ssh.FingerprintSHA256(key))
+	}
+}
+
+// ClientConfig returns config of client verifying host keys of server
+func (s *Server) ClientConfig(user string, auth ...ssh.AuthMethod) *ssh.ClientConfig {
+	return &ssh.ClientConfig{
+		User:            user,
+		Auth:            auth,
+		HostKeyCallback: s.HostKeyCallback(),
+	}
+}
+
+// Dial connects client to started server, host key is verified
+func (s *Server) Dial(user string, auth ...ssh.AuthMethod) (*ssh.Client, error) {
+	listener := s.getListener()
+	if listener == nil {
+		return nil, errors.New("server is not started")
+	}
+	addr := listener.Addr()
+	return ssh.Dial(addr.Network(), addr.String(), s.ClientConfig(user, auth...))
+}
+
+// DialPipe connects client to server over in-memory connection, see Pipe
+func (s *Server) DialPipe(user string, auth ...ssh.AuthMethod) (*ssh.Client, error) {
+	conn, chans, reqs, err := ssh.NewClientConn(s.Pipe(), "pipe", s.ClientConfig(user, auth...))
+	if err != nil {
+		return nil, err
+	}
+	return ssh.NewClient(conn, chans, reqs), nil
+}
@@ -0,0 +1,50 @@
+package sshtest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestServer_Dial(t *testing.T) {
+	server := NewTestServer(t, WithUserPassword("admin", "secret"))
+	server.MockExec("uptime", ExecResult{Stdout: "up"})
+	server.AddHostKey(NewEd25519Signer())
+	require.Len(t, server.HostKeys(), 2)
+
+	for name, dial := range map[string]func(user string, auth ...ssh.AuthMethod) (*ssh.Client, error){
+		"tcp":  server.Dial,
+		"pipe": server.DialPipe,
+	} {
+		t.Run(name, func(t *testing.T) {
+			client, err := dial("admin", ssh.Password("secret"))
+			require.NoError(t, err)
+			defer client.Close()
+			session, err := client.NewSession()
+			require.NoError(t, err)
+			output, err := session.Output("uptime")
+			require.NoError(t, err)
+			require.Equal(t, "up", string(output))
+
+			_, err = dial("admin", ssh.Password("wrong"))
+			require.Error(t, err)
+		})
+	}
+
+	config := server.ClientConfig("admin", ssh.Password("secret"))
+	config.HostKeyAlgorithms = []string{ssh.KeyAlgoED25519}
+	client, err := ssh.Dial("tcp", server.Addr(), config)
+	require.NoError(t, err)
+	_ = client.Close()
+
+	// key of other server is rejected
+	other := NewMockedServer()
+	config = other.ClientConfig("admin", ssh.Password("secret"))
+	_, err = ssh.Dial("tcp", server.Addr(), config)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "unknown host key")
+
+	_, err = other.Dial("admin")
+	require.EqualError(t, err, "server is not started")
+}
@@ -0,0 +1,46 @@
+package sshtest
+
+import (
+	"errors"
+	"reflect"
+	"unsafe"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// disconnectByApplication is SSH_DISCONNECT_BY_APPLICATION reason code
+const disconnectByApplication = 11
+
+// disconnectMsg is SSH_MSG_DISCONNECT
+type disconnectMsg struct {
+	Reason   uint32 `sshtype:"1"`
+	Message  string
+	Language string
+}
+
+var errDisconnectUnsupported = errors.New("ssh library doesn't allow to send disconnect message")
+
+// x/crypto/ssh has no API to send SSH_MSG_DISCONNECT after authentication,
+// so the message is written with the transport of the connection
+//
+//go:linkname handshakeWritePacket golang.org/x/crypto/ssh.(*handshakeTransport).writePacket
+func handshakeWritePacket(t unsafe.Pointer, p []byte) error
+
+// sendDisconnect sends SSH_MSG_DISCONNECT with reason to client,
+// errDisconnectUnsupported is returned if connection internals of x/crypto/ssh are changed
+func sendDisconnect(conn *ssh.ServerConn, reason string) error {
+	v := reflect.ValueOf(conn.Conn)
+	if v.Kind() != reflect.Pointer || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return errDisconnectUnsupported
+	}
+	transport := v.Elem().FieldByName("transport")
+	if !transport.IsValid() || transport.Kind() != reflect.Interface || transport.IsNil() {
+		return errDisconnectUnsupported
+	}
+	transport = transport.Elem()
+	if transport.Type().String() != "*ssh.handshakeTransport" || transport.IsNil() {
+		return errDisconnectUnsupported
+	}
+	msg := ssh.Marshal(&disconnectMsg{Reason: disconnectByApplication, Message: reason})
+	return handshakeWritePacket(transport.UnsafePointer(), msg)
+}
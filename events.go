@@ -0,0 +1,291 @@
+package sshtest
+
+import (
+	"sync"
+	"time"
+
+	"github.com/craftyhunter/go-sshtest/protocol"
+)
+
+// EventType is a kind of server lifecycle event
+type EventType string
+
+const (
+	EventConnect      EventType = "connect"
+	EventAuth         EventType = "auth"
+	EventChannelOpen  EventType = "channel-open"
+	EventRequest      EventType = "request"
+	EventExec         EventType = "exec"
+	EventChannelClose EventType = "channel-close"
+	EventDisconnect   EventType = "disconnect"
+)
+
+// Event is a lifecycle event of connection, channel or request
+type Event struct {
+	Type       EventType
+	Time       time.Time
+	Connection *Connection
+	// channel of channel and request events
+	Channel *Channel
+
+	// request type and parsed message of protocol package for request and exec events
+	Request string
+	Message interface{}
+	// command of exec event
+	Command string
+
+	// authentication method and its error for auth event, error is nil for accepted method
+	Method string
+	Err    error
+}
+
+// events dispatches lifecycle events to hooks and subscribers
+type events struct {
+	mu             sync.Mutex
+	onConnect      []func(c *Connection) error
+	onAuth         []func(c *Connection, method string, err error)
+	onChannelOpen  []func(ch *Channel)
+	onRequest      []func(ch *Channel, request string, msg interface{}) error
+	onExec         []func(ch *Channel, command string) *ExecResult
+	onChannelClose []func(ch *Channel)
+	onDisconnect   []func(c *Connection)
+	subscribers    map[*subscriber]struct{}
+}
+
+func newEvents() *events {
+	return &events{subscribers: make(map[*subscriber]struct{})}
+}
+
+// OnConnect adds hook called when client connects, connection is closed if hook returns error
+func (s *Server) OnConnect(hook func(c *Connection) error) {
+	s.events.mu.Lock()
+	s.events.onConnect = append(s.events.onConnect, hook)
+	s.events.mu.Unlock()
+}
+
+// OnAuth adds hook called for each authentication attempt, err is nil if method is accepted
+func (s *Server) OnAuth(hook func(c *Connection, method string, err error)) {
+	s.events.mu.Lock()
+	s.events.onAuth = append(s.events.onAuth, hook)
+	s.events.mu.Unlock()
+}
+
+// OnChannelOpen adds hook called when session channel is accepted
+func (s *Server) OnChannelOpen(hook func(ch *Channel)) {
+	s.events.mu.Lock()
+	s.events.onChannelOpen = append(s.events.onChannelOpen, hook)
+	s.events.mu.Unlock()
+}
+
+// OnRequest adds hook called for each channel request before it is handled,
+// request is rejected if hook returns error
+func (s *Server) OnRequest(hook func(ch *Channel, request string, msg interface{}) error) {
+	s.events.mu.Lock()
+	s.events.onRequest = append(s.events.onRequest, hook)
+	s.events.mu.Unlock()
+}
+
+// OnExec adds hook called for exec request, result returned by hook replaces mocked result
+// if it is not nil
+func (s *Server) OnExec(hook func(ch *Channel, command string) *ExecResult) {
+	s.events.mu.Lock()
+	s.events.onExec = append(s.events.onExec, hook)
+	s.events.mu.Unlock()
+}
+
+// OnChannelClose adds hook called when channel is closed
+func (s *Server) OnChannelClose(hook func(ch *Channel)) {
+	s.events.mu.Lock()
+	s.events.onChannelClose = append(s.events.onChannelClose, hook)
+	s.events.mu.Unlock()
+}
+
+// OnDisconnect adds hook called when connection is closed
+func (s *Server) OnDisconnect(hook func(c *Connection)) {
+	s.events.mu.Lock()
+	s.events.onDisconnect = append(s.events.onDisconnect, hook)
+	s.events.mu.Unlock()
+}
+
+// Subscribe returns channel of all events happened after the call and function which stops the subscription.
+// Events are queued without limit, so slow reader does not block server.
+func (s *Server) Subscribe() (<-chan Event, func()) {
+	sub := newSubscriber()
+	s.events.mu.Lock()
+	s.events.subscribers[sub] = struct{}{}
+	s.events.mu.Unlock()
+	var once sync.Once
+	return sub.out, func() {
+		once.Do(func() {
+			s.events.mu.Lock()
+			delete(s.events.subscribers, sub)
+			s.events.mu.Unlock()
+			sub.stop()
+		})
+	}
+}
+
+func (e *events) publish(event Event) {
+	event.Time = time.Now()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for sub := range e.subscribers {
+		sub.push(event)
+	}
+}
+
+func (e *events) connect(c *Connection) error {
+	if e == nil {
+		return nil
+	}
+	e.publish(Event{Type: EventConnect, Connection: c})
+	e.mu.Lock()
+	hooks := e.onConnect
+	e.mu.Unlock()
+	for _, hook := range hooks {
+		if err := hook(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *events) auth(c *Connection, method string, err error) {
+	if e == nil {
+		return
+	}
+	e.publish(Event{Type: EventAuth, Connection: c, Method: method, Err: err})
+	e.mu.Lock()
+	hooks := e.onAuth
+	e.mu.Unlock()
+	for _, hook := range hooks {
+		hook(c, method, err)
+	}
+}
+
+func (e *events) channelOpen(ch *Channel) {
+	if e == nil {
+		return
+	}
+	e.publish(Event{Type: EventChannelOpen, Connection: ch.conn, Channel: ch})
+	e.mu.Lock()
+	hooks := e.onChannelOpen
+	e.mu.Unlock()
+	for _, hook := range hooks {
+		hook(ch)
+	}
+}
+
+func (e *events) request(ch *Channel, request string, msg interface{}) error {
+	if e == nil {
+		return nil
+	}
+	e.publish(Event{Type: EventRequest, Connection: ch.conn, Channel: ch, Request: request, Message: msg})
+	e.mu.Lock()
+	hooks := e.onRequest
+	e.mu.Unlock()
+	for _, hook := range hooks {
+		if err := hook(ch, request, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *events) exec(ch *Channel, msg *protocol.MsgRequestExec) *ExecResult {
+	if e == nil {
+		return nil
+	}
+	e.publish(Event{Type: EventExec, Connection: ch.conn, Channel: ch, Request: protocol.MsgTypeExec, Message: msg, Command: msg.Command})
+	e.mu.Lock()
+	hooks := e.onExec
+	e.mu.Unlock()
+	var result *ExecResult
+	for _, hook := range hooks {
+		if r := hook(ch, msg.Command); r != nil {
+			result = r
+		}
+	}
+	return result
+}
+
+func (e *events) channelClose(ch *Channel) {
+	if e == nil {
+		return
+	}
+	e.publish(Event{Type: EventChannelClose, Connection: ch.conn, Channel: ch})
+	e.mu.Lock()
+	hooks := e.onChannelClose
+	e.mu.Unlock()
+	for _, hook := range hooks {
+		hook(ch)
+	}
+}
+
+func (e *events) disconnect(c *Connection) {
+	if e == nil {
+		return
+	}
+	e.publish(Event{Type: EventDisconnect, Connection: c})
+	e.mu.Lock()
+	hooks := e.onDisconnect
+	e.mu.Unlock()
+	for _, hook := range hooks {
+		hook(c)
+	}
+}
+
+// subscriber queues events and delivers them to out channel
+type subscriber struct {
+	out  chan Event
+	done chan struct{}
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	queue   []Event
+	stopped bool
+}
+
+func newSubscriber() *subscriber {
+	sub := &subscriber{out: make(chan Event), done: make(chan struct{})}
+	sub.cond = sync.NewCond(&sub.mu)
+	go sub.deliver()
+	return sub
+}
+
+func (sub *subscriber) push(event Event) {
+	sub.mu.Lock()
+	sub.queue = append(sub.queue, event)
+	sub.mu.Unlock()
+	sub.cond.Signal()
+}
+
+func (sub *subscriber) stop() {
+	sub.mu.Lock()
+	sub.stopped = true
+	sub.mu.Unlock()
+	sub.cond.Signal()
+	close(sub.done)
+}
+
+func (sub *subscriber) deliver() {
+	defer close(sub.out)
+	for {
+		sub.mu.Lock()
+		for len(sub.queue) == 0 && !sub.stopped {
+			sub.cond.Wait()
+		}
+		if sub.stopped {
+			sub.mu.Unlock()
+			return
+		}
+		event := sub.queue[0]
+		sub.queue = sub.queue[1:]
+		sub.mu.Unlock()
+		select {
+		case sub.out <- event:
+		case <-sub.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package sshtest
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/craftyhunter/go-sshtest/protocol"
+)
+
+func TestServer_Hooks(t *testing.T) {
+	server := NewTestServer(t, WithUserPassword("admin", "secret"))
+	var mu sync.Mutex
+	var auths []string
+	connects := 0
+	server.OnConnect(func(c *Connection) error {
+		mu.Lock()
+		defer mu.Unlock()
+		connects++
+		if connects > 1 {
+			return errors.New("only one connection is allowed")
+		}
+		return nil
+	})
+	server.OnAuth(func(c *Connection, method string, err error) {
+		mu.Lock()
+		auths = append(auths, method+" "+map[bool]string{true: "ok", false: "failed"}[err == nil])
+		mu.Unlock()
+	})
+	server.OnRequest(func(ch *Channel, request string, msg interface{}) error {
+		if env, ok := msg.(*protocol.MsgRequestSetEnv); ok && env.Name == "SECRET" {
+			return errors.New("env is not allowed")
+		}
+		return nil
+	})
+	server.OnExec(func(ch *Channel, command string) *ExecResult {
+		return &ExecResult{Stdout: "hooked " + command}
+	})
+	events, stop := server.Subscribe()
+	defer stop()
+
+	passwords := []string{"wrong", "secret"}
+	config := &ssh.ClientConfig{
+		User: "admin",
+		Auth: []ssh.AuthMethod{ssh.RetryableAuthMethod(ssh.PasswordCallback(func() (string, error) {
+			password := passwords[0]
+			passwords = passwords[1:]
+			return password, nil
+		}), 2)},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	}
+	clientConn, err := ssh.Dial("tcp", server.Addr(), config)
+	require.NoError(t, err)
+	session, err := clientConn.NewSession()
+	require.NoError(t, err)
+	require.Error(t, session.Setenv("SECRET", "1"))
+	require.NoError(t, session.Setenv("LANG", "C"))
+	output, err := session.Output("uptime")
+	require.NoError(t, err)
+	require.Equal(t, "hooked uptime", string(output))
+	_ = clientConn.Close()
+
+	passwords = []string{"secret"}
+	_, err = ssh.Dial("tcp", server.Addr(), config)
+	require.Error(t, err)
+
+	types := map[int][]EventType{}
+	disconnected := 0
+	for disconnected < 2 {
+		select {
+		case e := <-events:
+			require.False(t, e.Time.IsZero())
+			types[e.Connection.ID] = append(types[e.Connection.ID], e.Type)
+			if e.Type == EventExec {
+				require.Equal(t, "uptime", e.Command)
+				require.Equal(t, &protocol.MsgRequestExec{Command: "uptime"}, e.Message)
+			}
+			if e.Type == EventDisconnect {
+				disconnected++
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("not all events received: %v", types)
+		}
+	}
+	require.Equal(t, []EventType{
+		EventConnect, EventAuth, EventAuth, EventAuth, EventChannelOpen,
+		EventRequest, EventRequest, EventRequest, EventExec, EventChannelClose, EventDisconnect,
+	}, types[1])
+	require.Equal(t, []EventType{EventConnect, EventDisconnect}, types[2])
+	mu.Lock()
+	require.Equal(t, []string{"none failed", "password failed", "password ok"}, auths)
+	mu.Unlock()
+
+	stop()
+	_, ok := <-events
+	require.False(t, ok)
+}
@@ -0,0 +1,263 @@
+package sshtest
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/craftyhunter/go-sshtest/protocol"
+)
+
+// TestingT is a subset of testing.TB used to report failed expectations
+type TestingT interface {
+	Errorf(format string, args ...interface{})
+}
+
+// Expectations is a set of client requests expected by server, see MockData.Expect.
+// Exec commands which do not match any expectation are reported as unexpected.
+type Expectations struct {
+	mu         sync.Mutex
+	inOrder    bool
+	expected   []*Expectation
+	unexpected []string
+}
+
+// Expectation is a single expected request, it is expected once by default
+type Expectation struct {
+	parent *Expectations
+
+	request string
+	name    string
+	value   string
+	result  *mockedExecResultStatus
+
+	// count of matched requests is checked against [minTimes, maxTimes], maxTimes < 0 is unlimited
+	minTimes int
+	maxTimes int
+	count    int
+}
+
+// Expect returns expectations of client requests
+func (m *MockData) Expect() *Expectations {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.expectations == nil {
+		m.expectations = &Expectations{}
+	}
+	return m.expectations
+}
+
+func (m *MockData) getExpectations() *Expectations {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.expectations
+}
+
+// ExpectEnv expects env request with the name and value, any value matches if value is empty
+func (m *MockData) ExpectEnv(name, value string) *Expectation {
+	return m.Expect().Env(name, value)
+}
+
+// ExpectPTY expects pty-req request
+func (m *MockData) ExpectPTY() *Expectation {
+	return m.Expect().PTY()
+}
+
+// AssertExpectations reports unexpected requests and unmet expectations to t,
+// it returns true if all expectations are met
+func (m *MockData) AssertExpectations(t TestingT) bool {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+	if err := m.VerifyExpectations(); err != nil {
+		t.Errorf("%s", err)
+		return false
+	}
+	return true
+}
+
+// VerifyExpectations returns error describing unexpected requests, unmet expectations
+// and unmocked commands in strict mode
+func (m *MockData) VerifyExpectations() error {
+	var problems []string
+	if e := m.getExpectations(); e != nil {
+		e.mu.Lock()
+		problems = append(problems, e.unexpected...)
+		for _, exp := range e.expected {
+			if exp.count < exp.minTimes {
+				problems = append(problems, fmt.Sprintf("unmet expectation %s: expected %s, got %d", exp, exp.timesString(), exp.count))
+			}
+		}
+		e.mu.Unlock()
+	}
+	problems = append(problems, m.strictMisses()...)
+	if len(problems) > 0 {
+		return fmt.Errorf("%s", strings.Join(problems, "\n"))
+	}
+	return nil
+}
+
+// InOrder makes expectations to be met in the order they were added
+func (e *Expectations) InOrder() *Expectations {
+	e.mu.Lock()
+	e.inOrder = true
+	e.mu.Unlock()
+	return e
+}
+
+// AnyOrder allows expectations to be met in any order, it is default
+func (e *Expectations) AnyOrder() *Expectations {
+	e.mu.Lock()
+	e.inOrder = false
+	e.mu.Unlock()
+	return e
+}
+
+// Exec expects exec request of the command
+func (e *Expectations) Exec(command string) *Expectation {
+	return e.add(protocol.MsgTypeExec, command, "")
+}
+
+// Env expects env request with the name and value, any value matches if value is empty
+func (e *Expectations) Env(name, value string) *Expectation {
+	return e.add(protocol.MsgTypeEnv, name, value)
+}
+
+// PTY expects pty-req request
+func (e *Expectations) PTY() *Expectation {
+	return e.add(protocol.MsgTypePTYReq, "", "")
+}
+
+// Shell expects shell request
+func (e *Expectations) Shell() *Expectation {
+	return e.add(protocol.MsgTypeShell, "", "")
+}
+
+// Subsystem expects subsystem request with the name
+func (e *Expectations) Subsystem(name string) *Expectation {
+	return e.add(protocol.MsgTypeSubsystem, name, "")
+}
+
+func (e *Expectations) add(request, name, value string) *Expectation {
+	exp := &Expectation{parent: e, request: request, name: name, value: value, minTimes: 1, maxTimes: 1}
+	e.mu.Lock()
+	e.expected = append(e.expected, exp)
+	e.mu.Unlock()
+	return exp
+}
+
+// Times sets exact count of expected requests
+func (exp *Expectation) Times(n int) *Expectation {
+	exp.parent.mu.Lock()
+	exp.minTimes, exp.maxTimes = n, n
+	exp.parent.mu.Unlock()
+	return exp
+}
+
+// AnyTimes allows any count of requests including zero
+func (exp *Expectation) AnyTimes() *Expectation {
+	exp.parent.mu.Lock()
+	exp.minTimes, exp.maxTimes = 0, -1
+	exp.parent.mu.Unlock()
+	return exp
+}
+
+// AtLeast allows n or more requests
+func (exp *Expectation) AtLeast(n int) *Expectation {
+	exp.parent.mu.Lock()
+	exp.minTimes, exp.maxTimes = n, -1
+	exp.parent.mu.Unlock()
+	return exp
+}
+
+// Return sets result of expected exec, it takes precedence over MockExec results
+func (exp *Expectation) Return(result ExecResult) *Expectation {
+	exp.parent.mu.Lock()
+	mocked := result.mocked()
+	exp.result = &mocked
+	exp.parent.mu.Unlock()
+	return exp
+}
+
+func (exp *Expectation) String() string {
+	switch exp.request {
+	case protocol.MsgTypeExec, protocol.MsgTypeSubsystem:
+		return fmt.Sprintf("%s '%s'", exp.request, exp.name)
+	case protocol.MsgTypeEnv:
+		if exp.value != "" {
+			return fmt.Sprintf("%s '%s'='%s'", exp.request, exp.name, exp.value)
+		}
+		return fmt.Sprintf("%s '%s'", exp.request, exp.name)
+	}
+	return exp.request
+}
+
+func (exp *Expectation) timesString() string {
+	switch {
+	case exp.maxTimes < 0:
+		return fmt.Sprintf("at least %d times", exp.minTimes)
+	case exp.minTimes == exp.maxTimes:
+		return fmt.Sprintf("%d times", exp.minTimes)
+	}
+	return fmt.Sprintf("%d-%d times", exp.minTimes, exp.maxTimes)
+}
+
+func (exp *Expectation) match(request interface{}) bool {
+	switch msg := request.(type) {
+	case *protocol.MsgRequestExec:
+		return exp.request == protocol.MsgTypeExec && exp.name == msg.Command
+	case *protocol.MsgRequestSetEnv:
+		return exp.request == protocol.MsgTypeEnv && exp.name == msg.Name && (exp.value == "" || exp.value == msg.Value)
+	case *protocol.MsgRequestPTY:
+		return exp.request == protocol.MsgTypePTYReq
+	case *protocol.MsgRequestShell:
+		return exp.request == protocol.MsgTypeShell
+	case *protocol.MsgRequestSubsystem:
+		return exp.request == protocol.MsgTypeSubsystem && exp.name == msg.Name
+	}
+	return false
+}
+
+func (exp *Expectation) exhausted() bool {
+	return exp.maxTimes >= 0 && exp.count >= exp.maxTimes
+}
+
+// observe matches request against expectations and returns result of matched exec expectation if it is set
+func (e *Expectations) observe(request interface{}) *mockedExecResultStatus {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var matched *Expectation
+	index := -1
+	for i, exp := range e.expected {
+		if exp.match(request) {
+			if matched == nil {
+				matched, index = exp, i
+			}
+			if !exp.exhausted() {
+				matched, index = exp, i
+				break
+			}
+		}
+	}
+	if matched == nil {
+		if msg, ok := request.(*protocol.MsgRequestExec); ok {
+			e.unexpected = append(e.unexpected, fmt.Sprintf("unexpected %s '%s'", protocol.MsgTypeExec, msg.Command))
+		}
+		return nil
+	}
+
+	if matched.exhausted() {
+		e.unexpected = append(e.unexpected, fmt.Sprintf("unexpected %s: expected %s, got %d", matched, matched.timesString(), matched.count+1))
+	}
+	if e.inOrder {
+		for _, exp := range e.expected[:index] {
+			if exp.count < exp.minTimes {
+				e.unexpected = append(e.unexpected, fmt.Sprintf("%s happened before %s", matched, exp))
+				break
+			}
+		}
+	}
+	matched.count++
+	return matched.result
+}
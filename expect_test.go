@@ -0,0 +1,85 @@
+package sshtest
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+type fakeT struct {
+	errors []string
+}
+
+func (t *fakeT) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func TestServer_Expect(t *testing.T) {
+	server := NewMockedServer()
+	server.NoClientAuth = true
+	server.MockExec("uptime", ExecResult{Stdout: "mocked\n"})
+	server.Expect().Exec("uptime").Times(2).Return(ExecResult{Stdout: "up 1 day\n"})
+	server.ExpectEnv("LANG", "C")
+	server.ExpectPTY()
+	server.Expect().Exec("hostname")
+	host, port, err := server.Start()
+	require.NoError(t, err)
+	defer server.Stop()
+
+	client := NewTestClient()
+	clientConn, err := ssh.Dial("tcp", fmt.Sprintf("%s:%d", host, port), client.ClientConfig)
+	require.NoError(t, err)
+	defer clientConn.Close()
+
+	session, err := clientConn.NewSession()
+	require.NoError(t, err)
+	require.NoError(t, session.Setenv("LANG", "C"))
+	require.NoError(t, session.RequestPty("xterm", 24, 80, ssh.TerminalModes{}))
+	output, err := session.Output("uptime")
+	require.NoError(t, err)
+	require.Equal(t, "up 1 day\n", string(output))
+
+	ft := &fakeT{}
+	require.False(t, server.AssertExpectations(ft))
+	require.Equal(t, []string{"unmet expectation exec 'uptime': expected 2 times, got 1\nunmet expectation exec 'hostname': expected 1 times, got 0"}, ft.errors)
+
+	for _, command := range []string{"uptime", "hostname", "uptime", "whoami"} {
+		session, err = clientConn.NewSession()
+		require.NoError(t, err)
+		_, _ = session.Output(command)
+	}
+	err = server.VerifyExpectations()
+	require.Error(t, err)
+	require.Equal(t, "unexpected exec 'uptime': expected 2 times, got 3\nunexpected exec 'whoami'", err.Error())
+
+	server.ResetMocks()
+	require.True(t, server.AssertExpectations(t))
+}
+
+func TestServer_ExpectInOrder(t *testing.T) {
+	server := NewMockedServer()
+	server.NoClientAuth = true
+	server.Expect().InOrder()
+	server.Expect().Exec("first")
+	server.Expect().Exec("second").AnyTimes()
+	server.Expect().Exec("third")
+	host, port, err := server.Start()
+	require.NoError(t, err)
+	defer server.Stop()
+
+	client := NewTestClient()
+	clientConn, err := ssh.Dial("tcp", fmt.Sprintf("%s:%d", host, port), client.ClientConfig)
+	require.NoError(t, err)
+	defer clientConn.Close()
+
+	for _, command := range []string{"third", "first"} {
+		session, err := clientConn.NewSession()
+		require.NoError(t, err)
+		require.NoError(t, session.Run(command))
+	}
+	err = server.VerifyExpectations()
+	require.Error(t, err)
+	require.Equal(t, "exec 'third' happened before exec 'first'", err.Error())
+}
@@ -0,0 +1,154 @@
+package sshtest
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// permissions extension with name of authentication method used by client
+const extAuthMethod = "auth-method"
+
+// ConnectionLog is a stable JSON representation of served connection
+type ConnectionLog struct {
+	ID            int          `json:"id"`
+	RemoteAddr    string       `json:"remote_addr"`
+	ClientVersion string       `json:"client_version,omitempty"`
+	User          string       `json:"user,omitempty"`
+	Auth          *AuthLog     `json:"auth,omitempty"`
+	StartTime     time.Time    `json:"start_time"`
+	StopTime      *time.Time   `json:"stop_time,omitempty"`
+	Channels      []ChannelLog `json:"channels"`
+}
+
+// AuthLog describes how client was authenticated.
+// Method is "publickey", "password" or "none", extensions contain "pubkey-fp" for public keys.
+type AuthLog struct {
+	Method     string            `json:"method"`
+	Extensions map[string]string `json:"extensions,omitempty"`
+}
+
+// ChannelLog is a stable JSON representation of served channel
+type ChannelLog struct {
+	ID     int        `json:"id"`
+	Type   string     `json:"type"`
+	Events []EventLog `json:"events"`
+}
+
+// EventLog is a stable JSON representation of TranscriptEvent.
+// Name is a request type and Message is a parsed message of protocol package,
+// Data is base64 encoded.
+type EventLog struct {
+	Time      time.Time           `json:"time"`
+	Direction Direction           `json:"direction"`
+	Type      TranscriptEventType `json:"type"`
+	Name      string              `json:"name,omitempty"`
+	Message   interface{}         `json:"message,omitempty"`
+	Data      []byte              `json:"data,omitempty"`
+	Size      int                 `json:"size,omitempty"`
+}
+
+// EventLine is a single line of JSON Lines export, event with its connection and channel
+type EventLine struct {
+	Connection  int    `json:"connection"`
+	User        string `json:"user,omitempty"`
+	Channel     int    `json:"channel"`
+	ChannelType string `json:"channel_type"`
+	EventLog
+}
+
+// Export returns log of the connection with all channels and events
+func (c *Connection) Export() ConnectionLog {
+	c.mu.Lock()
+	log := ConnectionLog{
+		ID:        c.ID,
+		StartTime: c.startTime,
+		Channels:  []ChannelLog{},
+	}
+	if !c.stopTime.IsZero() {
+		stopTime := c.stopTime
+		log.StopTime = &stopTime
+	}
+	c.mu.Unlock()
+	log.RemoteAddr = c.RemoteAddr().String()
+
+	if clientConn := c.getClientConn(); clientConn != nil {
+		log.ClientVersion = string(clientConn.ClientVersion())
+		log.User = clientConn.User()
+		log.Auth = &AuthLog{Method: "none"}
+		if clientConn.Permissions != nil && len(clientConn.Permissions.Extensions) > 0 {
+			log.Auth.Extensions = map[string]string{}
+			for k, v := range clientConn.Permissions.Extensions {
+				if k == extAuthMethod {
+					log.Auth.Method = v
+					continue
+				}
+				log.Auth.Extensions[k] = v
+			}
+		}
+	}
+	for _, ch := range c.ServedChannels() {
+		log.Channels = append(log.Channels, ch.export())
+	}
+	return log
+}
+
+func (ch *Channel) export() ChannelLog {
+	log := ChannelLog{ID: ch.ID, Type: ch.Type, Events: []EventLog{}}
+	for _, e := range ch.Transcript() {
+		log.Events = append(log.Events, e.export())
+	}
+	return log
+}
+
+func (e TranscriptEvent) export() EventLog {
+	return EventLog{
+		Time:      e.Time,
+		Direction: e.Direction,
+		Type:      e.Type,
+		Name:      e.Name,
+		Message:   e.Request,
+		Data:      e.Data,
+		Size:      e.Size,
+	}
+}
+
+// Export returns log of all served connections
+func (s *Server) Export() []ConnectionLog {
+	logs := []ConnectionLog{}
+	for _, c := range s.ServedConnections() {
+		logs = append(logs, c.Export())
+	}
+	return logs
+}
+
+// WriteJSON writes log of all served connections as indented JSON array
+func (s *Server) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(s.Export())
+}
+
+// WriteJSONL writes events of all served connections in JSON Lines format, one EventLine per line.
+// Events are written channel by channel, the whole log is not kept in memory.
+func (s *Server) WriteJSONL(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	for _, c := range s.ServedConnections() {
+		user := c.User()
+		for _, ch := range c.ServedChannels() {
+			for _, e := range ch.Transcript() {
+				line := EventLine{
+					Connection:  c.ID,
+					User:        user,
+					Channel:     ch.ID,
+					ChannelType: ch.Type,
+					EventLog:    e.export(),
+				}
+				if err := encoder.Encode(line); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package sshtest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestServer_Export(t *testing.T) {
+	server := NewMockedServer()
+	server.AddUserPassword("admin", "secret")
+	server.MockExec("uptime", ExecResult{Stdout: "up 1 day\n", ExitStatus: 2})
+	host, port, err := server.Start()
+	require.NoError(t, err)
+
+	config := &ssh.ClientConfig{
+		User:            "admin",
+		Auth:            []ssh.AuthMethod{ssh.Password("secret")},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	}
+	clientConn, err := ssh.Dial("tcp", fmt.Sprintf("%s:%d", host, port), config)
+	require.NoError(t, err)
+	session, err := clientConn.NewSession()
+	require.NoError(t, err)
+	require.NoError(t, session.Setenv("LANG", "C"))
+	_, err = session.Output("uptime")
+	require.IsType(t, &ssh.ExitError{}, err)
+	_ = clientConn.Close()
+	server.Stop()
+	server.Wait()
+
+	buf := new(bytes.Buffer)
+	require.NoError(t, server.WriteJSON(buf))
+	var logs []ConnectionLog
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &logs))
+	require.Len(t, logs, 1)
+	c := logs[0]
+	require.Equal(t, 1, c.ID)
+	require.Equal(t, "admin", c.User)
+	require.Equal(t, &AuthLog{Method: "password"}, c.Auth)
+	require.NotNil(t, c.StopTime)
+	require.False(t, c.StopTime.Before(c.StartTime))
+	require.Len(t, c.Channels, 1)
+	require.Equal(t, "session", c.Channels[0].Type)
+
+	events := c.Channels[0].Events
+	require.Equal(t, "env", events[0].Name)
+	require.Equal(t, map[string]interface{}{"name": "LANG", "value": "C"}, events[0].Message)
+	require.Equal(t, "exec", events[1].Name)
+	require.Equal(t, map[string]interface{}{"command": "uptime"}, events[1].Message)
+	require.Equal(t, TranscriptStdout, events[2].Type)
+	require.Equal(t, []byte("up 1 day\n"), events[2].Data)
+	require.Equal(t, TranscriptEOF, events[3].Type)
+	require.Equal(t, TranscriptExitStatus, events[4].Type)
+	require.Equal(t, map[string]interface{}{"exit_status": float64(2)}, events[4].Message)
+
+	buf.Reset()
+	require.NoError(t, server.WriteJSONL(buf))
+	scanner := bufio.NewScanner(buf)
+	lines := 0
+	for scanner.Scan() {
+		var line EventLine
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &line))
+		require.Equal(t, 1, line.Connection)
+		require.Equal(t, 1, line.Channel)
+		require.Equal(t, "admin", line.User)
+		require.Equal(t, events[lines].Type, line.Type)
+		lines++
+	}
+	require.Equal(t, len(events), lines)
+}
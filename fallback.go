@@ -0,0 +1,83 @@
+package sshtest
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ExecFallback is a behavior of server for exec commands without mocked result
+type ExecFallback int
+
+const (
+	// ExecFallbackPermissive sends exit status 0 without output, it is default
+	ExecFallbackPermissive ExecFallback = iota
+	// ExecFallbackStrict sends exit status 127 with "command not found" on stderr
+	// and reports the command by VerifyExpectations and AssertExpectations
+	ExecFallbackStrict
+)
+
+// exit status of shell for command which is not found
+const exitStatusNotFound = 127
+
+// ExecHandler returns result of exec command without mocked result
+type ExecHandler func(command string) ExecResult
+
+// SetExecFallback sets behavior of server for unmocked exec commands
+func (m *MockData) SetExecFallback(f ExecFallback) {
+	m.mu.Lock()
+	m.execFallback = f
+	m.mu.Unlock()
+}
+
+// SetExecHandler sets handler of unmocked exec commands, it takes precedence over ExecFallback.
+// nil removes the handler.
+func (m *MockData) SetExecHandler(h ExecHandler) {
+	m.mu.Lock()
+	m.execHandler = h
+	m.mu.Unlock()
+}
+
+// UnmockedCommands returns exec commands received by server without mocked result
+func (m *MockData) UnmockedCommands() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string{}, m.unmockedCommands...)
+}
+
+// getFallbackResult records unmocked command and returns its result,
+// false is returned for permissive fallback
+func (m *MockData) getFallbackResult(command string) (mockedExecResultStatus, bool) {
+	m.mu.Lock()
+	m.unmockedCommands = append(m.unmockedCommands, command)
+	handler, fallback := m.execHandler, m.execFallback
+	if handler == nil && fallback == ExecFallbackStrict {
+		m.strictCommands = append(m.strictCommands, command)
+	}
+	m.mu.Unlock()
+
+	if handler != nil {
+		return handler(command).mocked(), true
+	}
+	if fallback == ExecFallbackStrict {
+		name := command
+		if fields := strings.Fields(command); len(fields) > 0 {
+			name = fields[0]
+		}
+		return mockedExecResultStatus{
+			exitStatus: exitStatusNotFound,
+			stderr:     fmt.Sprintf("sh: %s: command not found\n", name),
+		}, true
+	}
+	return mockedExecResultStatus{}, false
+}
+
+// strictMisses returns commands answered by strict fallback, they must be reported as failures
+func (m *MockData) strictMisses() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var misses []string
+	for _, command := range m.strictCommands {
+		misses = append(misses, fmt.Sprintf("unmocked exec '%s'", command))
+	}
+	return misses
+}
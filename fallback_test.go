@@ -0,0 +1,66 @@
+package sshtest
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestServer_ExecFallback(t *testing.T) {
+	server := NewMockedServer()
+	server.NoClientAuth = true
+	server.MockExec("uptime", ExecResult{Stdout: "up 1 day\n"})
+	host, port, err := server.Start()
+	require.NoError(t, err)
+	defer server.Stop()
+
+	client := NewTestClient()
+	clientConn, err := ssh.Dial("tcp", fmt.Sprintf("%s:%d", host, port), client.ClientConfig)
+	require.NoError(t, err)
+	defer clientConn.Close()
+
+	run := func(command string) (string, error) {
+		session, err := clientConn.NewSession()
+		require.NoError(t, err)
+		output, err := session.CombinedOutput(command)
+		return string(output), err
+	}
+
+	// permissive
+	output, err := run("rm -rf /tmp/cache")
+	require.NoError(t, err)
+	require.Empty(t, output)
+	require.NoError(t, server.VerifyExpectations())
+
+	// strict
+	server.SetExecFallback(ExecFallbackStrict)
+	output, err = run("uptime")
+	require.NoError(t, err)
+	require.Equal(t, "up 1 day\n", output)
+	output, err = run("uptme -p")
+	require.IsType(t, &ssh.ExitError{}, err)
+	require.Equal(t, 127, err.(*ssh.ExitError).ExitStatus())
+	require.Equal(t, "sh: uptme: command not found\n", output)
+	require.Equal(t, []string{"rm -rf /tmp/cache", "uptme -p"}, server.UnmockedCommands())
+	ft := &fakeT{}
+	require.False(t, server.AssertExpectations(ft))
+	require.Equal(t, []string{"unmocked exec 'uptme -p'"}, ft.errors)
+
+	// handler
+	server.SetExecHandler(func(command string) ExecResult {
+		return ExecResult{Stdout: "handled " + command, ExitStatus: 3}
+	})
+	output, err = run("id")
+	require.IsType(t, &ssh.ExitError{}, err)
+	require.Equal(t, 3, err.(*ssh.ExitError).ExitStatus())
+	require.Equal(t, "handled id", output)
+	// misses of strict mode are still reported
+	require.EqualError(t, server.VerifyExpectations(), "unmocked exec 'uptme -p'")
+	server.SetExecFallback(ExecFallbackPermissive)
+	require.Error(t, server.VerifyExpectations())
+
+	server.ResetMocks()
+	require.Empty(t, server.UnmockedCommands())
+}
@@ -0,0 +1,287 @@
+package sshtest
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+)
+
+// FaultPoint is a protocol point where fault is injected
+type FaultPoint int
+
+const (
+	// right after tcp connection is accepted
+	FaultOnConnect FaultPoint = iota
+	// after client version string is received
+	FaultAfterVersion
+	// after client KEXINIT message is received
+	FaultAfterKexInit
+	// when first message after key exchange is received, i.e. during auth
+	FaultDuringAuth
+	// after client is authenticated
+	FaultAfterAuth
+	// after Fault.Bytes bytes of channel data (stdout and stderr of all channels) were sent to client
+	FaultAfterBytes
+	// in the middle of mocked exec output
+	FaultDuringExecOutput
+)
+
+var faultPointNames = map[FaultPoint]string{
+	FaultOnConnect:        "on-connect",
+	FaultAfterVersion:     "after-version",
+	FaultAfterKexInit:     "after-kexinit",
+	FaultDuringAuth:       "during-auth",
+	FaultAfterAuth:        "after-auth",
+	FaultAfterBytes:       "after-bytes",
+	FaultDuringExecOutput: "during-exec-output",
+}
+
+func (p FaultPoint) String() string {
+	return faultPointNames[p]
+}
+
+// FaultAction is what happens with connection when fault is injected
+type FaultAction int
+
+const (
+	// close tcp connection
+	FaultClose FaultAction = iota
+	// close tcp connection with RST
+	FaultReset
+	// stop reading and writing for Fault.Delay, reads and writes in progress are finished
+	FaultStall
+	// send Fault.Garbage bytes (random bytes if empty) to client
+	FaultGarbage
+)
+
+var faultActionNames = map[FaultAction]string{
+	FaultClose:   "close",
+	FaultReset:   "reset",
+	FaultStall:   "stall",
+	FaultGarbage: "garbage",
+}
+
+func (a FaultAction) String() string {
+	return faultActionNames[a]
+}
+
+// Fault describes failure injected into a connection at chosen protocol point
+type Fault struct {
+	Point  FaultPoint
+	Action FaultAction
+
+	// channel data bytes count for FaultAfterBytes
+	Bytes int64
+	// stall duration for FaultStall
+	Delay time.Duration
+	// data for FaultGarbage
+	Garbage []byte
+
+	// number of first connections fault is injected to, all connections if 0
+	Connections int
+}
+
+// size of random data sent by FaultGarbage
+const defaultGarbageSize = 64
+
+const (
+	msgKexInit = 20
+	msgNewKeys = 21
+)
+
+// faultConn injects faults into wrapped connection.
+// It follows unencrypted part of client stream to find protocol points.
+type faultConn struct {
+	net.Conn
+	logger *slog.Logger
+
+	mu     sync.Mutex
+	faults []Fault
+
+	// state of client stream parsing
+	versionReceived bool
+	newKeysReceived bool
+	parsed          bool
+	packetHeader    []byte
+	packetRemaining int
+
+	// channel data bytes sent to client
+	written int64
+	// reads and writes wait till this time
+	stalledUntil time.Time
+}
+
+func newFaultConn(conn net.Conn, faults []Fault) *faultConn {
+	return &faultConn{
+		Conn:   conn,
+		logger: defaultLogger,
+		faults: faults,
+	}
+}
+
+func (c *faultConn) hasFault(point FaultPoint) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, f := range c.faults {
+		if f.Point == point {
+			return true
+		}
+	}
+	return false
+}
+
+// trigger injects all faults for point, each fault is injected once
+func (c *faultConn) trigger(point FaultPoint) {
+	c.mu.Lock()
+	var triggered []Fault
+	faults := c.faults[:0]
+	for _, f := range c.faults {
+		if f.Point == point {
+			triggered = append(triggered, f)
+		} else {
+			faults = append(faults, f)
+		}
+	}
+	c.faults = faults
+	c.mu.Unlock()
+
+	for _, f := range triggered {
+		c.inject(f)
+	}
+}
+
+func (c *faultConn) inject(f Fault) {
+	c.logger.Info("injecting fault", "action", f.Action.String(), "point", f.Point.String())
+	switch f.Action {
+	case FaultClose:
+		_ = c.Conn.Close()
+	case FaultReset:
+		if tcpConn, ok := c.Conn.(*net.TCPConn); ok {
+			_ = tcpConn.SetLinger(0)
+		}
+		_ = c.Conn.Close()
+	case FaultStall:
+		c.mu.Lock()
+		c.stalledUntil = time.Now().Add(f.Delay)
+		c.mu.Unlock()
+		time.Sleep(f.Delay)
+	case FaultGarbage:
+		garbage := f.Garbage
+		if len(garbage) == 0 {
+			garbage = make([]byte, defaultGarbageSize)
+			_, _ = rand.Read(garbage)
+		}
+		_, _ = c.Conn.Write(garbage)
+	}
+}
+
+// waitStall blocks till injected stall is over
+func (c *faultConn) waitStall() {
+	c.mu.Lock()
+	until := c.stalledUntil
+	c.mu.Unlock()
+	time.Sleep(time.Until(until))
+}
+
+func (c *faultConn) Read(b []byte) (n int, err error) {
+	c.waitStall()
+	n, err = c.Conn.Read(b)
+	for _, point := range c.parse(b[:n]) {
+		c.trigger(point)
+	}
+	return
+}
+
+func (c *faultConn) Write(b []byte) (int, error) {
+	c.waitStall()
+	return c.Conn.Write(b)
+}
+
+// bytesLeft returns channel data bytes left till the nearest FaultAfterBytes, -1 if there is no such fault
+func (c *faultConn) bytesLeft() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	left := int64(-1)
+	for _, f := range c.faults {
+		if f.Point != FaultAfterBytes {
+			continue
+		}
+		if l := f.Bytes - c.written; l < 0 {
+			left = 0
+		} else if left < 0 || l < left {
+			left = l
+		}
+	}
+	return left
+}
+
+// addChannelData counts channel data sent to client and injects FaultAfterBytes faults which limits are reached
+func (c *faultConn) addChannelData(n int) {
+	c.mu.Lock()
+	c.written += int64(n)
+	var triggered []Fault
+	faults := c.faults[:0]
+	for _, f := range c.faults {
+		if f.Point == FaultAfterBytes && f.Bytes <= c.written {
+			triggered = append(triggered, f)
+		} else {
+			faults = append(faults, f)
+		}
+	}
+	c.faults = faults
+	c.mu.Unlock()
+
+	for _, f := range triggered {
+		c.inject(f)
+	}
+}
+
+// parse follows client version string and unencrypted packets till NEWKEYS
+// and returns protocol points found in data
+func (c *faultConn) parse(data []byte) (points []FaultPoint) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(data) > 0 && !c.parsed {
+		switch {
+		case c.newKeysReceived:
+			// the rest of stream is encrypted
+			c.parsed = true
+			points = append(points, FaultDuringAuth)
+		case !c.versionReceived:
+			if data[0] == '\n' {
+				c.versionReceived = true
+				points = append(points, FaultAfterVersion)
+			}
+			data = data[1:]
+		case len(c.packetHeader) < 6:
+			// packet_length uint32, padding_length byte, message type byte
+			c.packetHeader = append(c.packetHeader, data[0])
+			data = data[1:]
+			if len(c.packetHeader) == 6 {
+				c.packetRemaining = int(binary.BigEndian.Uint32(c.packetHeader)) - 2
+			}
+		default:
+			n := c.packetRemaining
+			if n > len(data) {
+				n = len(data)
+			}
+			if n > 0 {
+				c.packetRemaining -= n
+				data = data[n:]
+			}
+			if c.packetRemaining <= 0 {
+				switch c.packetHeader[5] {
+				case msgKexInit:
+					points = append(points, FaultAfterKexInit)
+				case msgNewKeys:
+					c.newKeysReceived = true
+				}
+				c.packetHeader = c.packetHeader[:0]
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,113 @@
+package sshtest
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestServer_AddFault(t *testing.T) {
+	server := NewMockedServer()
+	server.ServerConfig.NoClientAuth = true
+	server.AddFault(Fault{Point: FaultAfterKexInit, Action: FaultClose, Connections: 1})
+	server.AddFault(Fault{Point: FaultDuringAuth, Action: FaultStall, Delay: time.Millisecond * 300})
+
+	host, port, err := server.Start()
+	require.NoError(t, err)
+
+	client := NewTestClient()
+	client.Command = "echo OK"
+	err = client.Connect(host, port)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "ssh: handshake failed")
+
+	// first fault is injected into the first connection only, the second one stalls at least for the delay
+	started := time.Now()
+	err = client.Connect(host, port)
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, time.Since(started), time.Millisecond*300)
+
+	server.Stop()
+	server.Wait()
+}
+
+func TestServer_AddFault_ExecOutput(t *testing.T) {
+	output := strings.Repeat("0123456789", 100)
+	server := NewMockedServer()
+	server.ServerConfig.NoClientAuth = true
+	server.MockExecResult("cat file", output, 0, 0)
+	server.AddFault(Fault{Point: FaultDuringExecOutput, Action: FaultReset})
+
+	host, port, err := server.Start()
+	require.NoError(t, err)
+
+	client := NewTestClient()
+	clientConn, err := ssh.Dial("tcp", fmt.Sprintf("%s:%d", host, port), client.ClientConfig)
+	require.NoError(t, err)
+	session, err := clientConn.NewSession()
+	require.NoError(t, err)
+
+	result, err := session.Output("cat file")
+	require.Error(t, err)
+	require.Equal(t, output[:len(output)/2], string(result))
+	_ = clientConn.Close()
+
+	server.Stop()
+	server.Wait()
+}
+
+func TestFaultConn_parse(t *testing.T) {
+	c := newFaultConn(nil, nil)
+	require.Empty(t, c.parse([]byte("SSH-2.0-")))
+	require.Equal(t, []FaultPoint{FaultAfterVersion}, c.parse([]byte("client\r\n\x00\x00\x00\x06")))
+	require.Empty(t, c.parse([]byte("\x04\x14\x00\x00")))
+	require.Equal(t, []FaultPoint{FaultAfterKexInit}, c.parse([]byte("\x00\x00\x00\x00\x00\x05\x03\x15\x00\x00")))
+	require.Equal(t, []FaultPoint{FaultDuringAuth}, c.parse([]byte("\x00encrypted")))
+	require.Empty(t, c.parse([]byte("encrypted")))
+}
+
+func TestServer_AddFault_AfterBytes(t *testing.T) {
+	output := strings.Repeat("0123456789", 100)
+	server := NewTestServer(t, WithNoClientAuth())
+	server.MockExec("cat file", ExecResult{Stdout: output})
+	// only faults which limits are reached are injected
+	server.AddFault(Fault{Point: FaultAfterBytes, Action: FaultStall, Bytes: 500, Delay: time.Millisecond})
+	server.AddFault(Fault{Point: FaultAfterBytes, Action: FaultClose, Bytes: 1500})
+
+	clientConn, err := server.Dial("admin")
+	require.NoError(t, err)
+	defer clientConn.Close()
+	session, err := clientConn.NewSession()
+	require.NoError(t, err)
+	result, err := session.Output("cat file")
+	require.NoError(t, err)
+	require.Equal(t, output, string(result))
+
+	session, err = clientConn.NewSession()
+	require.NoError(t, err)
+	result, err = session.Output("cat file")
+	require.Error(t, err)
+	require.Equal(t, output[:500], string(result))
+}
+
+func TestFaultConn_StallWrites(t *testing.T) {
+	const delay = 100 * time.Millisecond
+	client, server := newPipe()
+	defer client.Close()
+	conn := newFaultConn(server, []Fault{{Point: FaultAfterAuth, Action: FaultStall, Delay: delay}})
+
+	started := time.Now()
+	go conn.trigger(FaultAfterAuth)
+	require.Eventually(t, func() bool {
+		conn.mu.Lock()
+		defer conn.mu.Unlock()
+		return !conn.stalledUntil.IsZero()
+	}, time.Second, time.Millisecond)
+	_, err := conn.Write([]byte("data"))
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, time.Since(started), delay)
+}
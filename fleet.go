@@ -0,0 +1,235 @@
+package sshtest
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// FleetUser is user allowed to log in to fleet hosts
+const FleetUser = "sshtest"
+
+// Fleet is a set of mocked hosts served by one server, see NewFleet
+type Fleet struct {
+	// Server is the first host, other hosts are its virtual hosts
+	*Server
+
+	Hosts []*FleetHost
+
+	// credentials accepted by all hosts
+	User       string
+	Password   string
+	PrivateKey ed25519.PrivateKey
+	Signer     ssh.Signer
+}
+
+// FleetHost is a started host of fleet
+type FleetHost struct {
+	Name    string
+	Host    string
+	Port    int
+	HostKey ssh.PublicKey
+	Server  *Server
+}
+
+// Addr returns address of host in "host:port" form
+func (h *FleetHost) Addr() string {
+	return net.JoinHostPort(h.Host, strconv.Itoa(h.Port))
+}
+
+// NewFleet starts n hosts named host1..hostN on random ports of 127.0.0.1.
+// Every host has its own ed25519 host key and mocks, options are applied to each host.
+// Hosts accept FleetUser with generated password or client key, fleet is stopped with Stop.
+func NewFleet(n int, opts ...ServerOption) (*Fleet, error) {
+	if n < 1 {
+		return nil, fmt.Errorf("fleet must have at least one host, got %d", n)
+	}
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.NewSignerFromKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	password := make([]byte, 16)
+	if _, err = rand.Read(password); err != nil {
+		return nil, err
+	}
+	fleet := &Fleet{
+		User:       FleetUser,
+		Password:   hex.EncodeToString(password),
+		PrivateKey: privateKey,
+		Signer:     signer,
+	}
+	opts = append([]ServerOption{
+		WithUserPassword(fleet.User, fleet.Password),
+		WithAuthorizedKey(signer.PublicKey()),
+	}, opts...)
+
+	hostKeys := make([]ssh.Signer, n)
+	for i := range hostKeys {
+		hostKeys[i] = NewEd25519Signer()
+	}
+	fleet.Server = NewServer("127.0.0.1:0", hostKeys[0])
+	for _, opt := range opts {
+		opt(fleet.Server)
+	}
+	servers := []*Server{fleet.Server}
+	for _, hostKey := range hostKeys[1:] {
+		host, err := fleet.AddVirtualHost("127.0.0.1:0", hostKey, opts...)
+		if err != nil {
+			return nil, err
+		}
+		servers = append(servers, host)
+	}
+	// server stops started hosts if some host can't be started
+	if _, _, err = fleet.Start(); err != nil {
+		return nil, err
+	}
+
+	for i, server := range servers {
+		addr := server.getListener().Addr().(*net.TCPAddr)
+		fleet.Hosts = append(fleet.Hosts, &FleetHost{
+			Name:    fmt.Sprintf("host%d", i+1),
+			Host:    addr.IP.String(),
+			Port:    addr.Port,
+			HostKey: hostKeys[i].PublicKey(),
+			Server:  server,
+		})
+	}
+	return fleet, nil
+}
+
+// Host returns host by name
+func (f *Fleet) Host(name string) (*FleetHost, bool) {
+	for _, h := range f.Hosts {
+		if h.Name == name {
+			return h, true
+		}
+	}
+	return nil, false
+}
+
+// WritePrivateKey writes client private key in OpenSSH format
+func (f *Fleet) WritePrivateKey(w io.Writer) error {
+	block, err := ssh.MarshalPrivateKey(f.PrivateKey, FleetUser)
+	if err != nil {
+		return err
+	}
+	return pem.Encode(w, block)
+}
+
+// WriteKnownHosts writes host keys in known_hosts format
+func (f *Fleet) WriteKnownHosts(w io.Writer) error {
+	for _, h := range f.Hosts {
+		line := knownhosts.Line([]string{knownhosts.Normalize(h.Addr())}, h.HostKey)
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteSSHConfig writes OpenSSH client config with section of each host,
+// identityFile and knownHostsFile are skipped if empty
+func (f *Fleet) WriteSSHConfig(w io.Writer, identityFile, knownHostsFile string) error {
+	for _, h := range f.Hosts {
+		_, err := fmt.Fprintf(w, "Host %s\n  HostName %s\n  Port %d\n  User %s\n", h.Name, h.Host, h.Port, f.User)
+		if err != nil {
+			return err
+		}
+		if identityFile != "" {
+			if _, err = fmt.Fprintf(w, "  IdentityFile %s\n  IdentitiesOnly yes\n", quotePath(identityFile)); err != nil {
+				return err
+			}
+		}
+		if knownHostsFile != "" {
+			if _, err = fmt.Fprintf(w, "  UserKnownHostsFile %s\n  StrictHostKeyChecking yes\n", quotePath(knownHostsFile)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// WriteAnsibleInventory writes Ansible inventory in ini format with all hosts in group "sshtest",
+// password is used for authentication if identityFile is empty, knownHostsFile is skipped if empty
+func (f *Fleet) WriteAnsibleInventory(w io.Writer, identityFile, knownHostsFile string) error {
+	if _, err := fmt.Fprintln(w, "[sshtest]"); err != nil {
+		return err
+	}
+	for _, h := range f.Hosts {
+		if _, err := fmt.Fprintf(w, "%s ansible_host=%s ansible_port=%d\n", h.Name, h.Host, h.Port); err != nil {
+			return err
+		}
+	}
+	vars := fmt.Sprintf("\n[sshtest:vars]\nansible_user=%s\n", f.User)
+	if identityFile != "" {
+		vars += fmt.Sprintf("ansible_ssh_private_key_file=%s\n", quotePath(identityFile))
+	} else {
+		vars += fmt.Sprintf("ansible_password=%s\n", f.Password)
+	}
+	if knownHostsFile != "" {
+		vars += fmt.Sprintf("ansible_ssh_common_args='-o UserKnownHostsFile=%s'\n", quotePath(knownHostsFile))
+	}
+	_, err := io.WriteString(w, vars)
+	return err
+}
+
+// WriteFiles writes id_ed25519, known_hosts, ssh_config and inventory.ini to dir,
+// config and inventory refer to the key and known hosts files
+func (f *Fleet) WriteFiles(dir string) error {
+	identityFile, err := filepath.Abs(filepath.Join(dir, "id_ed25519"))
+	if err != nil {
+		return err
+	}
+	knownHostsFile := filepath.Join(filepath.Dir(identityFile), "known_hosts")
+	files := []struct {
+		name  string
+		perm  os.FileMode
+		write func(w io.Writer) error
+	}{
+		{"id_ed25519", 0600, f.WritePrivateKey},
+		{"known_hosts", 0644, f.WriteKnownHosts},
+		{"ssh_config", 0644, func(w io.Writer) error { return f.WriteSSHConfig(w, identityFile, knownHostsFile) }},
+		{"inventory.ini", 0644, func(w io.Writer) error { return f.WriteAnsibleInventory(w, identityFile, knownHostsFile) }},
+	}
+	for _, file := range files {
+		out, err := os.OpenFile(filepath.Join(dir, file.name), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, file.perm)
+		if err != nil {
+			return err
+		}
+		// permissions of existing file are not changed by OpenFile
+		err = out.Chmod(file.perm)
+		if err == nil {
+			err = file.write(out)
+		}
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// quotePath quotes path containing spaces for ssh_config and inventory
+func quotePath(path string) string {
+	if strings.ContainsAny(path, " \t") {
+		return `"` + path + `"`
+	}
+	return path
+}
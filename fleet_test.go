@@ -0,0 +1,79 @@
+package sshtest
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func TestNewFleet(t *testing.T) {
+	fleet, err := NewFleet(3, WithStopTimeout(0))
+	require.NoError(t, err)
+	defer fleet.Stop()
+	require.Len(t, fleet.Hosts, 3)
+	require.Len(t, fleet.VirtualHosts(), 2)
+
+	dir := filepath.Join(t.TempDir(), "fleet files")
+	require.NoError(t, os.Mkdir(dir, 0755))
+	// existing key file is made private
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "id_ed25519"), nil, 0644))
+	require.NoError(t, fleet.WriteFiles(dir))
+	info, err := os.Stat(filepath.Join(dir, "id_ed25519"))
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	hostKeyCallback, err := knownhosts.New(filepath.Join(dir, "known_hosts"))
+	require.NoError(t, err)
+	data, err := os.ReadFile(filepath.Join(dir, "ssh_config"))
+	require.NoError(t, err)
+	require.Contains(t, string(data), fmt.Sprintf("  UserKnownHostsFile \"%s\"\n", filepath.Join(dir, "known_hosts")))
+	data, err = os.ReadFile(filepath.Join(dir, "inventory.ini"))
+	require.NoError(t, err)
+	require.Contains(t, string(data), fmt.Sprintf("ansible_ssh_common_args='-o UserKnownHostsFile=\"%s\"'\n", filepath.Join(dir, "known_hosts")))
+	data, err = os.ReadFile(filepath.Join(dir, "id_ed25519"))
+	require.NoError(t, err)
+	signer, err := ssh.ParsePrivateKey(data)
+	require.NoError(t, err)
+
+	host, ok := fleet.Host("host2")
+	require.True(t, ok)
+	host.Server.MockExec("hostname", ExecResult{Stdout: "host2"})
+	for _, auth := range []ssh.AuthMethod{ssh.PublicKeys(signer), ssh.Password(fleet.Password)} {
+		config := &ssh.ClientConfig{User: FleetUser, Auth: []ssh.AuthMethod{auth}, HostKeyCallback: hostKeyCallback}
+		clientConn, err := ssh.Dial("tcp", host.Addr(), config)
+		require.NoError(t, err)
+		session, err := clientConn.NewSession()
+		require.NoError(t, err)
+		output, err := session.Output("hostname")
+		require.NoError(t, err)
+		require.Equal(t, "host2", string(output))
+		_ = clientConn.Close()
+	}
+
+	// host keys differ
+	config := &ssh.ClientConfig{User: FleetUser, Auth: []ssh.AuthMethod{ssh.PublicKeys(signer)}}
+	config.HostKeyCallback = ssh.FixedHostKey(fleet.Hosts[0].HostKey)
+	_, err = ssh.Dial("tcp", host.Addr(), config)
+	require.Error(t, err)
+
+	inventory := new(bytes.Buffer)
+	require.NoError(t, fleet.WriteAnsibleInventory(inventory, "", ""))
+	expected := "[sshtest]\n"
+	for i, h := range fleet.Hosts {
+		expected += fmt.Sprintf("host%d ansible_host=127.0.0.1 ansible_port=%d\n", i+1, h.Port)
+	}
+	expected += "\n[sshtest:vars]\nansible_user=sshtest\nansible_password=" + fleet.Password + "\n"
+	require.Equal(t, expected, inventory.String())
+
+	sshConfig := new(bytes.Buffer)
+	require.NoError(t, fleet.WriteSSHConfig(sshConfig, "", ""))
+	require.Contains(t, sshConfig.String(), fmt.Sprintf("Host host2\n  HostName 127.0.0.1\n  Port %d\n  User sshtest\nHost host3\n", host.Port))
+
+	_, err = NewFleet(0)
+	require.Error(t, err)
+}
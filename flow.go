@@ -0,0 +1,114 @@
+package sshtest
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// FlowControl describes how server reads client data from a channel.
+//
+// The window is adjusted when server reads data, so delaying reads delays
+// window adjustments and stopping reads makes client block when window is filled.
+// Tiny initial windows can't be advertised: golang.org/x/crypto/ssh always
+// sends 2MB initial window in channel open confirmation.
+type FlowControl struct {
+	// max bytes count read at once, unlimited if 0
+	ReadSize int
+	// delay before each read
+	ReadDelay time.Duration
+	// stop reading after this bytes count until ResumeReading is called, never stop if 0
+	StopAfter int64
+	// mocked exec result is sent after client closes stdin,
+	// by default it is sent at once and only exit status waits for closed stdin
+	ExecWaitEOF bool
+	// exit status is sent and channel is closed without waiting for client to close stdin,
+	// e.g. for OpenSSH clients run without -n, client data received later is not recorded
+	ExecCloseEarly bool
+}
+
+// flowReader reads channel data according to flow control settings
+type flowReader struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	r      io.Reader
+	fc     FlowControl
+	paused bool
+	closed bool
+	read   int64
+}
+
+func newFlowReader(fc FlowControl) *flowReader {
+	f := &flowReader{fc: fc}
+	f.cond = sync.NewCond(&f.mu)
+	return f
+}
+
+func (f *flowReader) setReader(r io.Reader) {
+	f.mu.Lock()
+	f.r = r
+	f.mu.Unlock()
+}
+
+func (f *flowReader) setFlowControl(fc FlowControl) {
+	f.mu.Lock()
+	f.fc = fc
+	f.cond.Broadcast()
+	f.mu.Unlock()
+}
+
+func (f *flowReader) getFlowControl() FlowControl {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.fc
+}
+
+func (f *flowReader) pause(paused bool) {
+	f.mu.Lock()
+	f.paused = paused
+	if !paused {
+		f.fc.StopAfter = 0
+	}
+	f.cond.Broadcast()
+	f.mu.Unlock()
+}
+
+// close unblocks paused reader
+func (f *flowReader) close() {
+	f.mu.Lock()
+	f.closed = true
+	f.cond.Broadcast()
+	f.mu.Unlock()
+}
+
+func (f *flowReader) stopped() bool {
+	return f.paused || (f.fc.StopAfter > 0 && f.read >= f.fc.StopAfter)
+}
+
+func (f *flowReader) Read(p []byte) (n int, err error) {
+	f.mu.Lock()
+	for f.stopped() && !f.closed {
+		f.cond.Wait()
+	}
+	if f.closed || f.r == nil {
+		f.mu.Unlock()
+		return 0, io.EOF
+	}
+	fc := f.fc
+	if fc.ReadSize > 0 && len(p) > fc.ReadSize {
+		p = p[:fc.ReadSize]
+	}
+	if fc.StopAfter > 0 && int64(len(p)) > fc.StopAfter-f.read {
+		p = p[:fc.StopAfter-f.read]
+	}
+	r := f.r
+	f.mu.Unlock()
+
+	time.Sleep(fc.ReadDelay)
+	n, err = r.Read(p)
+
+	f.mu.Lock()
+	f.read += int64(n)
+	f.mu.Unlock()
+	return
+}
@@ -0,0 +1,64 @@
+package sshtest
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestChannel_PauseReading(t *testing.T) {
+	server := NewMockedServer()
+	server.ServerConfig.NoClientAuth = true
+	server.MockExecResult("upload", "OK\n", 0, 0)
+	server.SetFlowControl(FlowControl{StopAfter: 1024, ExecWaitEOF: true})
+
+	host, port, err := server.Start()
+	require.NoError(t, err)
+
+	client := NewTestClient()
+	clientConn, err := ssh.Dial("tcp", fmt.Sprintf("%s:%d", host, port), client.ClientConfig)
+	require.NoError(t, err)
+	session, err := clientConn.NewSession()
+	require.NoError(t, err)
+
+	// more than channel window
+	session.Stdin = bytes.NewReader(make([]byte, 3<<20))
+	stdout := new(bytes.Buffer)
+	session.Stdout = stdout
+	require.NoError(t, session.Start("upload"))
+
+	done := make(chan error, 1)
+	go func() {
+		done <- session.Wait()
+	}()
+
+	// reading stops after StopAfter bytes whatever time it takes to get there
+	channel := server.ServedConnections()[0].ServedChannels()[0]
+	require.Eventually(t, func() bool {
+		return channel.StdinSize() == 1024
+	}, time.Second*5, time.Millisecond*10)
+	select {
+	case err = <-done:
+		t.Fatalf("session finished while server does not read: %v", err)
+	case <-time.After(time.Millisecond * 100):
+	}
+	require.Equal(t, int64(1024), channel.StdinSize())
+	require.Equal(t, int64(1024), channel.FlowControl().StopAfter)
+	channel.ResumeReading()
+
+	select {
+	case err = <-done:
+		require.NoError(t, err)
+	case <-time.After(time.Second * 5):
+		t.Fatal("session is not finished after reading was resumed")
+	}
+	require.Equal(t, "OK\n", stdout.String())
+	_ = clientConn.Close()
+
+	server.Stop()
+	server.Wait()
+}
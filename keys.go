@@ -1,6 +1,7 @@
 package sshtest
 
 import (
+	"crypto/ed25519"
 	"crypto/rand"
 	"crypto/rsa"
 
@@ -18,3 +19,10 @@ func NewSSHKeyPair(bitSize int) (private *rsa.PrivateKey, public ssh.PublicKey)
 	public, _ = ssh.NewPublicKey(&private.PublicKey)
 	return
 }
+
+// NewEd25519Signer generates ed25519 key, it is much faster than RSA for servers with many host keys
+func NewEd25519Signer() ssh.Signer {
+	_, key, _ := ed25519.GenerateKey(rand.Reader)
+	signer, _ := ssh.NewSignerFromKey(key)
+	return signer
+}
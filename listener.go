@@ -0,0 +1,272 @@
+package sshtest
+
+import (
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// listen listens on tcp address or on unix socket if addr is "unix:/path/to/socket"
+func listen(addr string) (net.Listener, error) {
+	network := "tcp"
+	if strings.HasPrefix(addr, "unix:") {
+		network, addr = "unix", strings.TrimPrefix(addr, "unix:")
+	}
+	return net.Listen(network, addr)
+}
+
+// StartListener starts serving connections accepted by listener, it is closed when server is stopped.
+// Virtual hosts are started too, server is stopped if any of them can't be started.
+func (s *Server) StartListener(listener net.Listener) error {
+	s.mu.Lock()
+	s.listener = listener
+	s.serverLogger = s.logger.With("server", listener.Addr().String())
+	hosts := append([]*Server{}, s.virtualHosts...)
+	s.mu.Unlock()
+
+	s.getLogger().Info("server started", "version", s.ServerVersion)
+
+	s.wg.Add(1)
+	go s.serve(listener)
+	if err := s.startVirtualHosts(hosts); err != nil {
+		s.Stop()
+		return err
+	}
+	return nil
+}
+
+// isStopping reports if server is stopped or stopping, s.mu must be held
+func (s *Server) isStopping() bool {
+	select {
+	case <-s.quit:
+		return true
+	default:
+		return false
+	}
+}
+
+// getLogger returns logger with server address if server is started
+func (s *Server) getLogger() *slog.Logger {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.serverLogger != nil {
+		return s.serverLogger
+	}
+	return s.logger
+}
+
+func (s *Server) getListener() net.Listener {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.listener
+}
+
+// ServeConn serves connection established by caller, e.g. one end of net.Pipe.
+// Writes to the connection are buffered, so unbuffered connections don't block version exchange.
+// Connection is closed and nil is returned if server is stopped.
+func (s *Server) ServeConn(netConn net.Conn) *Connection {
+	if _, ok := netConn.(*pipeConn); !ok {
+		netConn = newBufferedConn(netConn)
+	}
+	return s.serveConn(netConn)
+}
+
+func (s *Server) serveConn(netConn net.Conn) *Connection {
+	// no connections are added to wait group after shutdown is started
+	s.mu.Lock()
+	if s.isStopping() {
+		s.mu.Unlock()
+		_ = netConn.Close()
+		return nil
+	}
+	s.wg.Add(1)
+	// config is copied under the lock, SetPersonality changes it
+	config := *s.ServerConfig
+	s.mu.Unlock()
+
+	conn := NewConnection(netConn, s.MockData)
+	conn.ID = s.nextConnectionID()
+	conn.logger = s.getLogger().With("conn", conn.ID, "remote", netConn.RemoteAddr().String())
+	conn.events = s.events
+	conn.metrics = s.metrics
+	conn.logger.Debug("accepted new connection")
+	conn.injectFaults(s.faultsForConnection())
+	// data passes straight through until conditions are set, so they can be changed later
+	conn.SetNetworkConditions(s.getNetworkConditions())
+	s.appendConnection(conn)
+
+	go func() {
+		conn.handle(&config)
+		s.removeActiveConnection(conn)
+		s.wg.Done()
+	}()
+	return conn
+}
+
+// Pipe returns client end of in-memory connection served by server, server doesn't need to be started.
+// Unlike net.Pipe writes are buffered, so both ends can send version banners at once.
+func (s *Server) Pipe() net.Conn {
+	client, server := newPipe()
+	s.serveConn(server)
+	return client
+}
+
+// bufferedConn writes to connection from its own goroutine, so Write doesn't wait for the peer to read
+type bufferedConn struct {
+	net.Conn
+	out *pipeBuffer
+	// closed when buffered data is written
+	flushed chan struct{}
+}
+
+// bufferedFlushTimeout is max time Close waits for buffered data to be read by the peer
+const bufferedFlushTimeout = time.Second
+
+func newBufferedConn(conn net.Conn) *bufferedConn {
+	c := &bufferedConn{Conn: conn, out: newPipeBuffer(), flushed: make(chan struct{})}
+	go c.flush()
+	return c
+}
+
+func (c *bufferedConn) flush() {
+	defer close(c.flushed)
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := c.out.read(buf)
+		if err != nil {
+			return
+		}
+		if _, err = c.Conn.Write(buf[:n]); err != nil {
+			c.out.close()
+			return
+		}
+	}
+}
+
+func (c *bufferedConn) Write(p []byte) (int, error) {
+	return c.out.write(p)
+}
+
+// Close writes buffered data and closes connection
+func (c *bufferedConn) Close() error {
+	c.out.close()
+	select {
+	case <-c.flushed:
+	case <-time.After(bufferedFlushTimeout):
+	}
+	return c.Conn.Close()
+}
+
+// pipeAddr is address of both ends of in-memory connection
+type pipeAddr struct{}
+
+func (pipeAddr) Network() string { return "pipe" }
+func (pipeAddr) String() string  { return "pipe" }
+
+// newPipe returns ends of in-memory connection with buffered writes
+func newPipe() (net.Conn, net.Conn) {
+	a, b := newPipeBuffer(), newPipeBuffer()
+	return &pipeConn{in: a, out: b}, &pipeConn{in: b, out: a}
+}
+
+// pipeConn is end of in-memory connection
+type pipeConn struct {
+	in, out *pipeBuffer
+}
+
+func (c *pipeConn) Read(p []byte) (int, error)  { return c.in.read(p) }
+func (c *pipeConn) Write(p []byte) (int, error) { return c.out.write(p) }
+func (c *pipeConn) LocalAddr() net.Addr         { return pipeAddr{} }
+func (c *pipeConn) RemoteAddr() net.Addr        { return pipeAddr{} }
+
+func (c *pipeConn) Close() error {
+	c.in.close()
+	c.out.close()
+	return nil
+}
+
+func (c *pipeConn) SetDeadline(t time.Time) error {
+	return c.SetReadDeadline(t)
+}
+
+func (c *pipeConn) SetReadDeadline(t time.Time) error {
+	c.in.setDeadline(t)
+	return nil
+}
+
+// SetWriteDeadline does nothing, writes never block
+func (c *pipeConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+// pipeBuffer is one direction of in-memory connection
+type pipeBuffer struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	data     []byte
+	closed   bool
+	deadline time.Time
+	timer    *time.Timer
+}
+
+func newPipeBuffer() *pipeBuffer {
+	b := &pipeBuffer{}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+func (b *pipeBuffer) read(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for len(b.data) == 0 {
+		if b.closed {
+			return 0, io.EOF
+		}
+		if !b.deadline.IsZero() && !time.Now().Before(b.deadline) {
+			return 0, os.ErrDeadlineExceeded
+		}
+		b.cond.Wait()
+	}
+	n := copy(p, b.data)
+	b.data = b.data[n:]
+	return n, nil
+}
+
+func (b *pipeBuffer) write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return 0, io.ErrClosedPipe
+	}
+	b.data = append(b.data, p...)
+	b.cond.Broadcast()
+	return len(p), nil
+}
+
+func (b *pipeBuffer) close() {
+	b.mu.Lock()
+	b.closed = true
+	b.cond.Broadcast()
+	b.mu.Unlock()
+}
+
+func (b *pipeBuffer) setDeadline(t time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.deadline = t
+	if b.timer != nil {
+		b.timer.Stop()
+	}
+	if !t.IsZero() {
+		b.timer = time.AfterFunc(time.Until(t), func() {
+			b.mu.Lock()
+			b.cond.Broadcast()
+			b.mu.Unlock()
+		})
+	}
+	b.cond.Broadcast()
+}
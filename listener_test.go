@@ -0,0 +1,129 @@
+package sshtest
+
+import (
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestServer_StartUnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ssh.sock")
+	server := NewTestServer(t, WithNoClientAuth(), WithListenAddr("unix:"+path))
+	server.MockExec("uptime", ExecResult{Stdout: "up"})
+	require.Equal(t, path, server.Addr())
+
+	clientConn, err := ssh.Dial("unix", path, NewTestClient().ClientConfig)
+	require.NoError(t, err)
+	defer clientConn.Close()
+	session, err := clientConn.NewSession()
+	require.NoError(t, err)
+	output, err := session.Output("uptime")
+	require.NoError(t, err)
+	require.Equal(t, "up", string(output))
+}
+
+func TestServer_StartListener(t *testing.T) {
+	server := NewMockedServer()
+	server.NoClientAuth = true
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	require.NoError(t, server.StartListener(listener))
+	require.Equal(t, listener.Addr().String(), server.Addr())
+
+	clientConn, err := ssh.Dial("tcp", server.Addr(), NewTestClient().ClientConfig)
+	require.NoError(t, err)
+	_ = clientConn.Close()
+	server.Stop()
+	_, err = listener.Accept()
+	require.Error(t, err)
+}
+
+func TestServer_Pipe(t *testing.T) {
+	server := NewMockedServer()
+	server.NoClientAuth = true
+	server.StopTimeout = time.Second
+	server.MockExec("uptime", ExecResult{Stdout: "up"})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conn, chans, reqs, err := ssh.NewClientConn(server.Pipe(), "pipe", NewTestClient().ClientConfig)
+			require.NoError(t, err)
+			clientConn := ssh.NewClient(conn, chans, reqs)
+			defer clientConn.Close()
+			session, err := clientConn.NewSession()
+			require.NoError(t, err)
+			output, err := session.Output("uptime")
+			require.NoError(t, err)
+			require.Equal(t, "up", string(output))
+		}()
+	}
+	wg.Wait()
+	require.Len(t, server.ServedConnections(), 10)
+	require.Equal(t, "pipe", server.ServedConnections()[0].RemoteAddr().String())
+
+	server.Stop()
+	conn, _ := newPipe()
+	require.Nil(t, server.ServeConn(conn))
+}
+
+func TestPipe_Deadline(t *testing.T) {
+	client, server := newPipe()
+	require.NoError(t, client.SetReadDeadline(time.Now().Add(10*time.Millisecond)))
+	_, err := client.Read(make([]byte, 1))
+	require.ErrorIs(t, err, os.ErrDeadlineExceeded)
+
+	require.NoError(t, client.SetReadDeadline(time.Time{}))
+	_, err = server.Write([]byte("ok"))
+	require.NoError(t, err)
+	_ = server.Close()
+	data, err := io.ReadAll(client)
+	require.NoError(t, err)
+	require.Equal(t, "ok", string(data))
+	_, err = server.Write([]byte("closed"))
+	require.ErrorIs(t, err, io.ErrClosedPipe)
+}
+
+func TestServer_ServeConnNetPipe(t *testing.T) {
+	server := NewMockedServer()
+	server.NoClientAuth = true
+	server.StopTimeout = time.Second
+	defer server.Stop()
+	server.MockExec("uptime", ExecResult{Stdout: "up"})
+
+	clientEnd, serverEnd := net.Pipe()
+	require.NotNil(t, server.ServeConn(serverEnd))
+	conn, chans, reqs, err := ssh.NewClientConn(clientEnd, "pipe", NewTestClient().ClientConfig)
+	require.NoError(t, err)
+	client := ssh.NewClient(conn, chans, reqs)
+	defer client.Close()
+	session, err := client.NewSession()
+	require.NoError(t, err)
+	output, err := session.Output("uptime")
+	require.NoError(t, err)
+	require.Equal(t, "up", string(output))
+}
+
+func TestBufferedConn_CloseFlushes(t *testing.T) {
+	serverEnd, clientEnd := net.Pipe()
+	conn := newBufferedConn(serverEnd)
+	_, err := conn.Write([]byte("exit-status"))
+	require.NoError(t, err)
+	closed := make(chan error, 1)
+	go func() {
+		closed <- conn.Close()
+	}()
+	data, err := io.ReadAll(clientEnd)
+	require.NoError(t, err)
+	require.Equal(t, "exit-status", string(data))
+	require.NoError(t, <-closed)
+}
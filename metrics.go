@@ -0,0 +1,239 @@
+package sshtest
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// sources of exec results in sshtest_exec_total metric
+const (
+	execSourceMock        = "mock"
+	execSourceExpectation = "expectation"
+	execSourceHook        = "hook"
+	execSourceFallback    = "fallback"
+	execSourceUnmocked    = "unmocked"
+	execSourceProxy       = "proxy"
+)
+
+// handshakeBuckets are upper bounds of handshake duration histogram in seconds
+var handshakeBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// metrics are server-wide counters exported in Prometheus text format
+type metrics struct {
+	connectionsAccepted atomic.Int64
+	connectionsActive   atomic.Int64
+	channelsOpened      atomic.Int64
+	channelsActive      atomic.Int64
+	bytesReceived       atomic.Int64
+	bytesSent           atomic.Int64
+
+	authAttempts *counterVec
+	requests     *counterVec
+	execs        *counterVec
+	handshake    *histogram
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		authAttempts: newCounterVec("method", "result"),
+		requests:     newCounterVec("type"),
+		execs:        newCounterVec("source", "command"),
+		handshake:    newHistogram(handshakeBuckets),
+	}
+}
+
+func (m *metrics) connectionOpened() {
+	if m == nil {
+		return
+	}
+	m.connectionsAccepted.Add(1)
+	m.connectionsActive.Add(1)
+}
+
+func (m *metrics) connectionClosed() {
+	if m == nil {
+		return
+	}
+	m.connectionsActive.Add(-1)
+}
+
+func (m *metrics) auth(method string, err error, handshake time.Duration) {
+	if m == nil {
+		return
+	}
+	if err != nil {
+		if method == "none" {
+			// clients start with "none" to learn the allowed methods, it isn't a failed attempt
+			return
+		}
+		m.authAttempts.inc(method, "failure")
+		return
+	}
+	m.authAttempts.inc(method, "success")
+	m.handshake.observe(handshake.Seconds())
+}
+
+func (m *metrics) channelOpened() {
+	if m == nil {
+		return
+	}
+	m.channelsOpened.Add(1)
+	m.channelsActive.Add(1)
+}
+
+func (m *metrics) channelClosed() {
+	if m == nil {
+		return
+	}
+	m.channelsActive.Add(-1)
+}
+
+func (m *metrics) request(requestType string) {
+	if m == nil {
+		return
+	}
+	m.requests.inc(requestType)
+}
+
+// exec counts exec result source, command is a label of mocked commands only to limit cardinality
+func (m *metrics) exec(source, command string) {
+	if m == nil {
+		return
+	}
+	if source != execSourceMock {
+		command = ""
+	}
+	m.execs.inc(source, command)
+}
+
+func (m *metrics) received(n int) {
+	if m != nil && n > 0 {
+		m.bytesReceived.Add(int64(n))
+	}
+}
+
+func (m *metrics) sent(n int) {
+	if m != nil && n > 0 {
+		m.bytesSent.Add(int64(n))
+	}
+}
+
+// WriteMetrics writes server metrics in Prometheus text format
+func (s *Server) WriteMetrics(w io.Writer) error {
+	m := s.metrics
+	b := new(strings.Builder)
+	writeMetric(b, "sshtest_connections_accepted_total", "counter", "Connections accepted by server.", m.connectionsAccepted.Load())
+	writeMetric(b, "sshtest_connections_active", "gauge", "Connections being served.", m.connectionsActive.Load())
+	m.authAttempts.write(b, "sshtest_auth_attempts_total", "Authentication attempts by method and result.")
+	m.handshake.write(b, "sshtest_handshake_duration_seconds", "Time from connect to successful authentication.")
+	writeMetric(b, "sshtest_channels_opened_total", "counter", "Session channels opened by clients.", m.channelsOpened.Load())
+	writeMetric(b, "sshtest_channels_active", "gauge", "Session channels being served.", m.channelsActive.Load())
+	m.requests.write(b, "sshtest_requests_total", "Channel requests by type.")
+	m.execs.write(b, "sshtest_exec_total", "Exec commands by result source and mocked command.")
+	writeMetric(b, "sshtest_bytes_received_total", "counter", "Bytes received from clients.", m.bytesReceived.Load())
+	writeMetric(b, "sshtest_bytes_sent_total", "counter", "Bytes sent to clients.", m.bytesSent.Load())
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// MetricsHandler returns http handler of server metrics in Prometheus text format
+func (s *Server) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		if err := s.WriteMetrics(w); err != nil {
+			s.getLogger().Warn("could not write metrics", "error", err)
+		}
+	})
+}
+
+func writeMetric(b *strings.Builder, name, metricType, help string, value int64) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n%s %d\n", name, help, name, metricType, name, value)
+}
+
+// counterVec is a counter with labels
+type counterVec struct {
+	names []string
+
+	mu     sync.Mutex
+	values map[string]int64
+}
+
+func newCounterVec(names ...string) *counterVec {
+	return &counterVec{names: names, values: make(map[string]int64)}
+}
+
+func (c *counterVec) inc(labels ...string) {
+	key := strings.Join(labels, "\xff")
+	c.mu.Lock()
+	c.values[key]++
+	c.mu.Unlock()
+}
+
+func (c *counterVec) write(b *strings.Builder, name, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	keys := make([]string, 0, len(c.values))
+	for key := range c.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		labels := make([]string, len(c.names))
+		for i, value := range strings.Split(key, "\xff") {
+			labels[i] = fmt.Sprintf("%s=%s", c.names[i], quoteLabel(value))
+		}
+		fmt.Fprintf(b, "%s{%s} %d\n", name, strings.Join(labels, ","), c.values[key])
+	}
+}
+
+// quoteLabel quotes label value escaping backslash, double quote and line feed
+func quoteLabel(value string) string {
+	value = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+	return `"` + value + `"`
+}
+
+// histogram counts observed values in cumulative buckets
+type histogram struct {
+	buckets []float64
+
+	mu     sync.Mutex
+	counts []int64
+	count  int64
+	sum    float64
+}
+
+func newHistogram(buckets []float64) *histogram {
+	return &histogram{buckets: buckets, counts: make([]int64, len(buckets))}
+}
+
+func (h *histogram) observe(value float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, bound := range h.buckets {
+		if value <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += value
+}
+
+func (h *histogram) write(b *strings.Builder, name, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, bound := range h.buckets {
+		fmt.Fprintf(b, "%s_bucket{le=\"%s\"} %d\n", name, strconv.FormatFloat(bound, 'g', -1, 64), h.counts[i])
+	}
+	fmt.Fprintf(b, "%s_bucket{le=\"+Inf\"} %d\n", name, h.count)
+	fmt.Fprintf(b, "%s_sum %s\n", name, strconv.FormatFloat(h.sum, 'g', -1, 64))
+	fmt.Fprintf(b, "%s_count %d\n", name, h.count)
+}
@@ -0,0 +1,81 @@
+package sshtest
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestServer_WriteMetrics(t *testing.T) {
+	server := NewTestServer(t, WithUserPassword("admin", "secret"))
+	server.MockExec("uptime", ExecResult{Stdout: "up 1 day\n"})
+	server.Expect().Exec("reboot").Return(ExecResult{ExitStatus: 1})
+
+	config := &ssh.ClientConfig{
+		User:            "admin",
+		Auth:            []ssh.AuthMethod{ssh.Password("secret")},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	}
+	clientConn, err := ssh.Dial("tcp", server.Addr(), config)
+	require.NoError(t, err)
+	for _, command := range []string{"uptime", "reboot", "id"} {
+		session, err := clientConn.NewSession()
+		require.NoError(t, err)
+		_ = session.Run(command)
+	}
+	_ = clientConn.Close()
+	c, ok := server.Connection(1)
+	require.True(t, ok)
+	require.NoError(t, c.WaitClosed(time.Second))
+
+	recorder := httptest.NewRecorder()
+	server.AdminHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	require.Equal(t, 200, recorder.Code)
+	require.Equal(t, "text/plain; version=0.0.4", recorder.Header().Get("Content-Type"))
+	lines := strings.Split(recorder.Body.String(), "\n")
+	for _, line := range []string{
+		"# TYPE sshtest_connections_accepted_total counter",
+		"sshtest_connections_accepted_total 1",
+		"sshtest_connections_active 0",
+		`sshtest_auth_attempts_total{method="password",result="success"} 1`,
+		`sshtest_handshake_duration_seconds_bucket{le="+Inf"} 1`,
+		"sshtest_handshake_duration_seconds_count 1",
+		"sshtest_channels_opened_total 3",
+		"sshtest_channels_active 0",
+		`sshtest_requests_total{type="exec"} 3`,
+		`sshtest_exec_total{source="expectation",command=""} 1`,
+		`sshtest_exec_total{source="mock",command="uptime"} 1`,
+		`sshtest_exec_total{source="unmocked",command=""} 1`,
+	} {
+		require.Contains(t, lines, line)
+	}
+	require.NotContains(t, recorder.Body.String(), `method="none"`)
+}
+
+// rejectedNewChannel is a new channel which can't be accepted
+type rejectedNewChannel struct {
+	ssh.NewChannel
+}
+
+func (rejectedNewChannel) ChannelType() string { return "session" }
+func (rejectedNewChannel) Accept() (ssh.Channel, <-chan *ssh.Request, error) {
+	return nil, nil, errors.New("connection closed")
+}
+
+func TestChannel_MetricsAcceptFailure(t *testing.T) {
+	conn := &Connection{metrics: newMetrics()}
+	ch := NewChannel(rejectedNewChannel{}, NewMockData())
+	ch.conn = conn
+	ch.handle()
+	require.Equal(t, int64(0), conn.metrics.channelsOpened.Load())
+	require.Equal(t, int64(0), conn.metrics.channelsActive.Load())
+}
+
+func TestQuoteLabel(t *testing.T) {
+	require.Equal(t, `"say \"hi\"\\n\n"`, quoteLabel("say \"hi\"\\n\n"))
+}
@@ -10,6 +10,7 @@ func NewMockData() *MockData {
 		mu: sync.Mutex{},
 
 		mockedExecRequests: make(map[string]mockedExecResultStatus),
+		mockedSubsystems:   make(map[string]mockedExecResultStatus),
 	}
 }
 
@@ -17,14 +18,45 @@ type MockData struct {
 	mu sync.Mutex
 
 	mockedExecRequests map[string]mockedExecResultStatus
+	mockedSubsystems   map[string]mockedExecResultStatus
+	personality        *Personality
+	flowControl        FlowControl
+	stdinOptions       StdinOptions
+	recordingOptions   RecordingOptions
+	proxy              *Proxy
+	expectations       *Expectations
+	execFallback       ExecFallback
+	execHandler        ExecHandler
+	unmockedCommands   []string
+	// unmocked commands answered by strict fallback
+	strictCommands []string
 }
 
 type mockedExecResultStatus struct {
 	exitStatus uint32
 	result     string
+	stderr     string
 	timeout    time.Duration
 }
 
+// ExecResult is a mocked result of exec request
+type ExecResult struct {
+	Stdout     string
+	Stderr     string
+	ExitStatus uint32
+	// delay before result is sent
+	Delay time.Duration
+}
+
+func (r ExecResult) mocked() mockedExecResultStatus {
+	return mockedExecResultStatus{
+		exitStatus: r.ExitStatus,
+		result:     r.Stdout,
+		stderr:     r.Stderr,
+		timeout:    r.Delay,
+	}
+}
+
 func (m *MockData) getMocksExecResult() map[string]mockedExecResultStatus {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -35,6 +67,21 @@ func (m *MockData) getMocksExecResult() map[string]mockedExecResultStatus {
 	return result
 }
 
+// getExecResult looks for command in mocked exec results and then in personality commands
+func (m *MockData) getExecResult(command string) (mockedExecResultStatus, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if out, ok := m.mockedExecRequests[command]; ok {
+		return out, true
+	}
+	if m.personality != nil {
+		if out, ok := m.personality.Commands[command]; ok {
+			return mockedExecResultStatus{exitStatus: out.ExitStatus, result: out.Output}, true
+		}
+	}
+	return mockedExecResultStatus{}, false
+}
+
 func (m *MockData) MockExecResult(command, result string, timeout time.Duration, exitStatus uint32) {
 	m.mu.Lock()
 	m.mockedExecRequests[command] = mockedExecResultStatus{
@@ -44,3 +91,113 @@ func (m *MockData) MockExecResult(command, result string, timeout time.Duration,
 	}
 	m.mu.Unlock()
 }
+
+// MockExec sets result of command
+func (m *MockData) MockExec(command string, result ExecResult) {
+	m.mu.Lock()
+	m.mockedExecRequests[command] = result.mocked()
+	m.mu.Unlock()
+}
+
+// MockSubsystem makes server accept subsystem request and send result
+func (m *MockData) MockSubsystem(name string, result ExecResult) {
+	m.mu.Lock()
+	m.mockedSubsystems[name] = result.mocked()
+	m.mu.Unlock()
+}
+
+func (m *MockData) getSubsystemResult(name string) (mockedExecResultStatus, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out, ok := m.mockedSubsystems[name]
+	return out, ok
+}
+
+// RemoveExecMock removes mocked result of command
+func (m *MockData) RemoveExecMock(command string) {
+	m.mu.Lock()
+	delete(m.mockedExecRequests, command)
+	m.mu.Unlock()
+}
+
+// RemoveSubsystemMock removes mocked result of subsystem
+func (m *MockData) RemoveSubsystemMock(name string) {
+	m.mu.Lock()
+	delete(m.mockedSubsystems, name)
+	m.mu.Unlock()
+}
+
+// ResetMocks removes all mocked exec and subsystem results and expectations
+func (m *MockData) ResetMocks() {
+	m.mu.Lock()
+	m.mockedExecRequests = make(map[string]mockedExecResultStatus)
+	m.mockedSubsystems = make(map[string]mockedExecResultStatus)
+	m.expectations = nil
+	m.unmockedCommands = nil
+	m.strictCommands = nil
+	m.mu.Unlock()
+}
+
+func (m *MockData) setPersonality(p *Personality) {
+	m.mu.Lock()
+	m.personality = p
+	m.mu.Unlock()
+}
+
+func (m *MockData) getPersonality() *Personality {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.personality
+}
+
+// SetFlowControl sets how client data is read from channels opened after the call
+func (m *MockData) SetFlowControl(fc FlowControl) {
+	m.mu.Lock()
+	m.flowControl = fc
+	m.mu.Unlock()
+}
+
+func (m *MockData) getFlowControl() FlowControl {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.flowControl
+}
+
+// SetStdinOptions sets limits of client data recording for channels opened after the call
+func (m *MockData) SetStdinOptions(opts StdinOptions) {
+	m.mu.Lock()
+	m.stdinOptions = opts
+	m.mu.Unlock()
+}
+
+func (m *MockData) getStdinOptions() StdinOptions {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.stdinOptions
+}
+
+// SetRecordingOptions enables recording of terminal sessions to files
+func (m *MockData) SetRecordingOptions(opts RecordingOptions) {
+	m.mu.Lock()
+	m.recordingOptions = opts
+	m.mu.Unlock()
+}
+
+func (m *MockData) getRecordingOptions() RecordingOptions {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.recordingOptions
+}
+
+// SetProxy makes server forward exec, shell and subsystem requests to upstream server, nil disables forwarding
+func (m *MockData) SetProxy(p *Proxy) {
+	m.mu.Lock()
+	m.proxy = p
+	m.mu.Unlock()
+}
+
+func (m *MockData) getProxy() *Proxy {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.proxy
+}
@@ -0,0 +1,315 @@
+package sshtest
+
+import (
+	"io"
+	"math/rand"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// NetworkConditions describes simulated network link between client and server
+type NetworkConditions struct {
+	// one way delay of data sent in both directions
+	Latency time.Duration
+	// random delay up to Jitter added to Latency
+	Jitter time.Duration
+	// bytes per second from client to server, unlimited if 0
+	UploadRate int64
+	// bytes per second from server to client, unlimited if 0
+	DownloadRate int64
+}
+
+// rate limited data is sent by chunks sized for this interval
+const throttleInterval = time.Millisecond * 50
+
+// max bytes count in flight in one direction, reads and writes block when it is reached
+const maxDelayed = 1 << 20
+
+// throttledConn adds latency and bandwidth limits to wrapped connection.
+// Data is delayed in delay lines, so data in flight overlaps like on a real link.
+// Reads and writes go straight to wrapped connection until non-zero conditions are set.
+type throttledConn struct {
+	net.Conn
+
+	// delay lines are used after non-zero conditions are set
+	started atomic.Bool
+	// serializes reads of wrapped connection
+	readMu sync.Mutex
+
+	mu         sync.Mutex
+	conditions NetworkConditions
+	// time when next chunk can be read or written
+	nextRead  time.Time
+	nextWrite time.Time
+
+	// data received from client and data to send to client
+	in, out *delayLine
+	// serializes writes of delayed data and data written without delay
+	writeMu sync.Mutex
+	// closed when out is drained
+	sent chan struct{}
+}
+
+func newThrottledConn(conn net.Conn, conditions NetworkConditions) *throttledConn {
+	c := &throttledConn{
+		Conn: conn,
+		in:   newDelayLine(),
+		out:  newDelayLine(),
+		sent: make(chan struct{}),
+	}
+	c.setConditions(conditions)
+	return c
+}
+
+func (c *throttledConn) setConditions(conditions NetworkConditions) {
+	c.mu.Lock()
+	c.conditions = conditions
+	c.mu.Unlock()
+	if conditions != (NetworkConditions{}) && !c.started.Swap(true) {
+		go c.receive()
+		go c.send()
+	}
+}
+
+func (c *throttledConn) getConditions() NetworkConditions {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conditions
+}
+
+func (nc NetworkConditions) delay() time.Duration {
+	delay := nc.Latency
+	if nc.Jitter > 0 {
+		delay += time.Duration(rand.Int63n(int64(nc.Jitter)))
+	}
+	return delay
+}
+
+// chunkSize returns max bytes count which can be transferred at once with rate
+func chunkSize(rate int64, size int) int {
+	if rate <= 0 {
+		return size
+	}
+	chunk := int(rate * int64(throttleInterval) / int64(time.Second))
+	if chunk < 1 {
+		chunk = 1
+	}
+	if chunk > size {
+		chunk = size
+	}
+	return chunk
+}
+
+// wait blocks until next chunk is allowed and reserves time for n bytes
+func (c *throttledConn) wait(next *time.Time, rate int64, n int) {
+	if rate <= 0 {
+		return
+	}
+	c.mu.Lock()
+	now := time.Now()
+	if next.Before(now) {
+		*next = now
+	}
+	start := *next
+	*next = next.Add(time.Duration(int64(n) * int64(time.Second) / rate))
+	c.mu.Unlock()
+	time.Sleep(time.Until(start))
+}
+
+func (c *throttledConn) receive() {
+	buf := make([]byte, 32*1024)
+	for {
+		c.readMu.Lock()
+		n, err := c.Conn.Read(buf)
+		c.readMu.Unlock()
+		if n > 0 {
+			_ = c.in.push(buf[:n], time.Now().Add(c.getConditions().delay()))
+		}
+		if err != nil {
+			c.in.close(err)
+			return
+		}
+	}
+}
+
+func (c *throttledConn) send() {
+	defer close(c.sent)
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := c.out.read(buf)
+		if err != nil {
+			return
+		}
+		c.writeMu.Lock()
+		_, err = c.Conn.Write(buf[:n])
+		c.out.done(n)
+		c.writeMu.Unlock()
+		if err != nil {
+			c.out.close(err)
+			return
+		}
+	}
+}
+
+func (c *throttledConn) Read(b []byte) (n int, err error) {
+	if !c.started.Load() {
+		c.readMu.Lock()
+		if !c.started.Load() {
+			// receive waits for this read, so data stays in order
+			defer c.readMu.Unlock()
+			return c.Conn.Read(b)
+		}
+		c.readMu.Unlock()
+	}
+	nc := c.getConditions()
+	n, err = c.in.read(b[:chunkSize(nc.UploadRate, len(b))])
+	c.in.done(n)
+	if n > 0 {
+		c.wait(&c.nextRead, nc.UploadRate, n)
+	}
+	return
+}
+
+func (c *throttledConn) Write(b []byte) (n int, err error) {
+	nc := c.getConditions()
+	for n < len(b) {
+		chunk := chunkSize(nc.DownloadRate, len(b)-n)
+		c.wait(&c.nextWrite, nc.DownloadRate, chunk)
+		if delay := nc.delay(); delay > 0 {
+			err = c.out.push(b[n:n+chunk], time.Now().Add(delay))
+		} else {
+			err = c.writeNow(b[n : n+chunk])
+		}
+		if err != nil {
+			return
+		}
+		n += chunk
+	}
+	return
+}
+
+// writeNow writes data without delay if no delayed data is in flight
+func (c *throttledConn) writeNow(b []byte) error {
+	c.writeMu.Lock()
+	if c.out.empty() {
+		_, err := c.Conn.Write(b)
+		c.writeMu.Unlock()
+		return err
+	}
+	c.writeMu.Unlock()
+	return c.out.push(b, time.Now())
+}
+
+// Close waits for data in flight to be sent and closes connection
+func (c *throttledConn) Close() error {
+	nc := c.getConditions()
+	c.out.close(nil)
+	if c.started.Load() {
+		select {
+		case <-c.sent:
+		case <-time.After(nc.Latency + nc.Jitter + time.Second):
+		}
+	}
+	err := c.Conn.Close()
+	c.in.close(nil)
+	return err
+}
+
+// delayLine is a queue of data delivered in order not earlier than its delivery time
+type delayLine struct {
+	mu    sync.Mutex
+	cond  *sync.Cond
+	queue []delayedData
+	// bytes pushed and not done yet
+	pending int
+	closed  bool
+	err     error
+}
+
+type delayedData struct {
+	data []byte
+	at   time.Time
+}
+
+func newDelayLine() *delayLine {
+	l := &delayLine{}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+// push adds copy of data delivered at time at, but not before data pushed earlier.
+// It blocks while maxDelayed bytes are not delivered, so peer sees back-pressure.
+func (l *delayLine) push(data []byte, at time.Time) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for l.pending >= maxDelayed && !l.closed {
+		l.cond.Wait()
+	}
+	if l.closed {
+		if l.err != nil {
+			return l.err
+		}
+		return net.ErrClosed
+	}
+	if len(l.queue) > 0 && at.Before(l.queue[len(l.queue)-1].at) {
+		at = l.queue[len(l.queue)-1].at
+	}
+	l.queue = append(l.queue, delayedData{data: append([]byte{}, data...), at: at})
+	l.pending += len(data)
+	l.cond.Broadcast()
+	return nil
+}
+
+// read waits for delivery time of the first data in queue, error is returned when queue is closed and drained
+func (l *delayLine) read(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for len(l.queue) == 0 {
+		if l.closed {
+			if l.err != nil {
+				return 0, l.err
+			}
+			return 0, io.EOF
+		}
+		l.cond.Wait()
+	}
+	if wait := time.Until(l.queue[0].at); wait > 0 {
+		// only one reader takes data from queue, so the first data stays
+		l.mu.Unlock()
+		time.Sleep(wait)
+		l.mu.Lock()
+	}
+	n := copy(p, l.queue[0].data)
+	l.queue[0].data = l.queue[0].data[n:]
+	if len(l.queue[0].data) == 0 {
+		l.queue = l.queue[1:]
+	}
+	return n, nil
+}
+
+// done marks n bytes of read data as delivered
+func (l *delayLine) done(n int) {
+	l.mu.Lock()
+	l.pending -= n
+	l.cond.Broadcast()
+	l.mu.Unlock()
+}
+
+// empty reports if all pushed data is delivered
+func (l *delayLine) empty() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.pending == 0
+}
+
+// close stops accepting data, queued data is still delivered
+func (l *delayLine) close(err error) {
+	l.mu.Lock()
+	if !l.closed {
+		l.closed, l.err = true, err
+	}
+	l.cond.Broadcast()
+	l.mu.Unlock()
+}
@@ -0,0 +1,109 @@
+package sshtest
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestServer_SetNetworkConditions(t *testing.T) {
+	output := strings.Repeat("0123456789", 2000)
+	server := NewMockedServer()
+	server.ServerConfig.NoClientAuth = true
+	server.MockExecResult("cat file", output, 0, 0)
+
+	host, port, err := server.Start()
+	require.NoError(t, err)
+
+	client := NewTestClient()
+	clientConn, err := ssh.Dial("tcp", fmt.Sprintf("%s:%d", host, port), client.ClientConfig)
+	require.NoError(t, err)
+
+	// conditions are changed for already served connections too
+	conditions := NetworkConditions{Latency: time.Millisecond * 20, DownloadRate: 40000}
+	server.SetNetworkConditions(conditions)
+	require.Equal(t, conditions, server.ServedConnections()[0].NetworkConditions())
+
+	session, err := clientConn.NewSession()
+	require.NoError(t, err)
+	started := time.Now()
+	result, err := session.Output("cat file")
+	require.NoError(t, err)
+	require.Equal(t, output, string(result))
+	// 20000 bytes take 500ms at 40000 bytes per second, the lower bound leaves room for bursts
+	require.GreaterOrEqual(t, time.Since(started), time.Millisecond*250)
+	_ = clientConn.Close()
+
+	server.Stop()
+	server.Wait()
+}
+
+func TestChunkSize(t *testing.T) {
+	require.Equal(t, 100, chunkSize(0, 100))
+	require.Equal(t, 50, chunkSize(1000, 100))
+	require.Equal(t, 1, chunkSize(1, 100))
+	require.Equal(t, 10, chunkSize(1000000, 10))
+}
+
+func TestThrottledConn_Latency(t *testing.T) {
+	const latency = 100 * time.Millisecond
+	const writes = 10
+	client, server := newPipe()
+	conn := newThrottledConn(server, NetworkConditions{Latency: latency})
+	defer conn.Close()
+
+	// data in flight overlaps, so writes are delivered after one latency, not one latency per write
+	started := time.Now()
+	for i := 0; i < writes; i++ {
+		_, err := conn.Write([]byte{byte(i)})
+		require.NoError(t, err)
+	}
+	received := make([]byte, writes)
+	_, err := io.ReadFull(client, received)
+	require.NoError(t, err)
+	elapsed := time.Since(started)
+	require.Equal(t, []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, received)
+	require.GreaterOrEqual(t, elapsed, latency)
+	require.Less(t, elapsed, writes*latency/2)
+
+	started = time.Now()
+	for i := 0; i < writes; i++ {
+		_, err := client.Write([]byte{byte(i)})
+		require.NoError(t, err)
+	}
+	_, err = io.ReadFull(conn, received)
+	require.NoError(t, err)
+	elapsed = time.Since(started)
+	require.GreaterOrEqual(t, elapsed, latency)
+	require.Less(t, elapsed, writes*latency/2)
+}
+
+func TestThrottledConn_PassThrough(t *testing.T) {
+	client, server := newPipe()
+	conn := newThrottledConn(server, NetworkConditions{})
+	defer conn.Close()
+
+	// client data is not read ahead without conditions
+	_, err := client.Write([]byte("ping"))
+	require.NoError(t, err)
+	time.Sleep(10 * time.Millisecond)
+	require.False(t, conn.started.Load())
+	require.True(t, conn.in.empty())
+	received := make([]byte, 4)
+	_, err = io.ReadFull(conn, received)
+	require.NoError(t, err)
+	require.Equal(t, "ping", string(received))
+
+	conn.setConditions(NetworkConditions{Latency: time.Millisecond})
+	require.True(t, conn.started.Load())
+	_, err = conn.Write([]byte("pong"))
+	require.NoError(t, err)
+	_, err = io.ReadFull(client, received)
+	require.NoError(t, err)
+	require.Equal(t, "pong", string(received))
+}
@@ -0,0 +1,80 @@
+package sshtest
+
+import (
+	"log/slog"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// ServerOption changes server before it is started, see NewTestServer
+type ServerOption func(s *Server)
+
+// WithListenAddr sets listen address of server, "localhost:0" by default
+func WithListenAddr(addr string) ServerOption {
+	return func(s *Server) {
+		s.listenAddr = addr
+	}
+}
+
+// WithHostKey adds host key to server, it replaces generated key of the same type
+func WithHostKey(key ssh.Signer) ServerOption {
+	return func(s *Server) {
+		s.AddHostKey(key)
+	}
+}
+
+// WithNoClientAuth allows clients without authentication
+func WithNoClientAuth() ServerOption {
+	return func(s *Server) {
+		s.NoClientAuth = true
+	}
+}
+
+// WithAuthorizedKey authorizes client key for any user
+func WithAuthorizedKey(key ssh.PublicKey) ServerOption {
+	return func(s *Server) {
+		s.AddAuthorizedKey(key)
+	}
+}
+
+// WithUserPassword allows user to authenticate with password
+func WithUserPassword(user, password string) ServerOption {
+	return func(s *Server) {
+		s.AddUserPassword(user, password)
+	}
+}
+
+// WithPersonality sets personality of server
+func WithPersonality(p *Personality) ServerOption {
+	return func(s *Server) {
+		s.SetPersonality(p)
+	}
+}
+
+// WithStopTimeout sets timeout before clients are disconnected when server is stopping
+func WithStopTimeout(timeout time.Duration) ServerOption {
+	return func(s *Server) {
+		s.mu.Lock()
+		s.StopTimeout = timeout
+		s.mu.Unlock()
+	}
+}
+
+// WithLogger sets logger of server, its connections and channels.
+// Records have attributes "server", "conn" and "channel" with ids of connections and channels.
+func WithLogger(logger *slog.Logger) ServerOption {
+	return func(s *Server) {
+		s.mu.Lock()
+		s.logger = logger
+		if s.listener != nil {
+			s.serverLogger = logger.With("server", s.listener.Addr().String())
+		}
+		s.mu.Unlock()
+	}
+}
+
+// WithLogf makes server write log records of all levels to logf
+func WithLogf(logf Logf) ServerOption {
+	return WithLogger(NewLogfLogger(logf))
+}
@@ -0,0 +1,243 @@
+package sshtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const (
+	// placeholders which can be used in Personality.Prompt and Personality.UnknownCommand
+	placeholderUser    = "{user}"
+	placeholderCommand = "{command}"
+)
+
+// Personality describes how a mocked server looks like for a client:
+// version banner, algorithms, shell prompt, paging and canned command outputs.
+// Personalities can be loaded from json files with LoadPersonality.
+type Personality struct {
+	Name string `json:"name" yaml:"name"`
+
+	// ssh version banner, e.g. "SSH-2.0-Cisco-1.25"
+	ServerVersion string `json:"server_version" yaml:"server_version"`
+
+	// allowed algorithms, server defaults are used if empty
+	KeyExchanges []string `json:"key_exchanges,omitempty" yaml:"key_exchanges,omitempty"`
+	Ciphers      []string `json:"ciphers,omitempty" yaml:"ciphers,omitempty"`
+	MACs         []string `json:"macs,omitempty" yaml:"macs,omitempty"`
+
+	// text written once when shell is started
+	MOTD string `json:"motd,omitempty" yaml:"motd,omitempty"`
+	// shell prompt, {user} is replaced with the name of the connected user
+	Prompt string `json:"prompt" yaml:"prompt"`
+
+	// text written when output is paused, e.g. " --More-- "
+	PagerPrompt string `json:"pager_prompt,omitempty" yaml:"pager_prompt,omitempty"`
+	// number of output lines per page, paging is disabled when 0
+	PageLines int `json:"page_lines,omitempty" yaml:"page_lines,omitempty"`
+	// commands which disable paging for the rest of the shell session
+	PagingOffCommands []string `json:"paging_off_commands,omitempty" yaml:"paging_off_commands,omitempty"`
+
+	// commands which close the shell, "exit", "quit" and "logout" are used if empty
+	ExitCommands []string `json:"exit_commands,omitempty" yaml:"exit_commands,omitempty"`
+	// output for commands without result, {command} is replaced with the command
+	UnknownCommand string `json:"unknown_command,omitempty" yaml:"unknown_command,omitempty"`
+
+	Commands map[string]PersonalityCommand `json:"commands,omitempty" yaml:"commands,omitempty"`
+}
+
+// PersonalityCommand is a canned result of a command in shell or exec request
+type PersonalityCommand struct {
+	Output     string `json:"output" yaml:"output"`
+	ExitStatus uint32 `json:"exit_status,omitempty" yaml:"exit_status,omitempty"`
+}
+
+var defaultExitCommands = []string{"exit", "quit", "logout"}
+
+func (p *Personality) prompt(user string) string {
+	return strings.Replace(p.Prompt, placeholderUser, user, -1)
+}
+
+func (p *Personality) unknownCommand(command string) string {
+	return strings.Replace(p.UnknownCommand, placeholderCommand, command, -1)
+}
+
+func (p *Personality) isExitCommand(command string) bool {
+	exitCommands := p.ExitCommands
+	if len(exitCommands) == 0 {
+		exitCommands = defaultExitCommands
+	}
+	return containsString(exitCommands, command)
+}
+
+func (p *Personality) isPagingOffCommand(command string) bool {
+	return containsString(p.PagingOffCommands, command)
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadPersonality reads personality from json file
+func LoadPersonality(path string) (*Personality, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p := new(Personality)
+	if err = json.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("wrong personality file %s: %s", path, err)
+	}
+	if p.Name == "" {
+		p.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	return p, nil
+}
+
+// LoadPersonalities reads all *.json files from dir and registers them
+func LoadPersonalities(dir string) error {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		p, err := LoadPersonality(path)
+		if err != nil {
+			return err
+		}
+		RegisterPersonality(p)
+	}
+	return nil
+}
+
+// SavePersonality writes personality to json file
+func SavePersonality(path string, p *Personality) error {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, os.FileMode(0644))
+}
+
+var (
+	personalitiesMu sync.Mutex
+	personalities   = map[string]*Personality{}
+)
+
+// RegisterPersonality makes personality available by name with GetPersonality
+func RegisterPersonality(p *Personality) {
+	personalitiesMu.Lock()
+	personalities[p.Name] = p
+	personalitiesMu.Unlock()
+}
+
+// GetPersonality returns registered personality by name
+func GetPersonality(name string) (*Personality, bool) {
+	personalitiesMu.Lock()
+	defer personalitiesMu.Unlock()
+	p, ok := personalities[name]
+	return p, ok
+}
+
+func init() {
+	RegisterPersonality(PersonalityCiscoIOS15)
+	RegisterPersonality(PersonalityJuniperJunos)
+	RegisterPersonality(PersonalityMikroTikRouterOS)
+}
+
+// PersonalityCiscoIOS15 emulates Cisco IOS 15 router in privileged mode
+var PersonalityCiscoIOS15 = &Personality{
+	Name:              "cisco-ios-15",
+	ServerVersion:     "SSH-2.0-Cisco-1.25",
+	KeyExchanges:      []string{"diffie-hellman-group14-sha1"},
+	Ciphers:           []string{"aes128-ctr", "aes192-ctr", "aes256-ctr"},
+	MACs:              []string{"hmac-sha1"},
+	Prompt:            "Router#",
+	PagerPrompt:       " --More-- ",
+	PageLines:         24,
+	PagingOffCommands: []string{"terminal length 0"},
+	UnknownCommand:    "                    ^\n% Invalid input detected at '^' marker.\n",
+	Commands: map[string]PersonalityCommand{
+		"terminal length 0": {},
+		"show version": {Output: "Cisco IOS Software, C2900 Software (C2900-UNIVERSALK9-M), Version 15.2(4)M7, RELEASE SOFTWARE (fc2)\n" +
+			"Technical Support: http://www.cisco.com/techsupport\n" +
+			"Copyright (c) 1986-2014 by Cisco Systems, Inc.\n" +
+			"Compiled Thu 25-Sep-14 10:36 by prod_rel_team\n" +
+			"\n" +
+			"ROM: System Bootstrap, Version 15.0(1r)M16, RELEASE SOFTWARE (fc1)\n" +
+			"\n" +
+			"Router uptime is 1 week, 2 days, 3 hours, 4 minutes\n" +
+			"System returned to ROM by power-on\n" +
+			"System image file is \"flash0:c2900-universalk9-mz.SPA.152-4.M7.bin\"\n" +
+			"\n" +
+			"Cisco CISCO2911/K9 (revision 1.0) with 483328K/40960K bytes of memory.\n" +
+			"Processor board ID FTX0000A0AA\n" +
+			"3 Gigabit Ethernet interfaces\n" +
+			"DRAM configuration is 64 bits wide with parity enabled.\n" +
+			"255K bytes of non-volatile configuration memory.\n" +
+			"250880K bytes of ATA System CompactFlash 0 (Read/Write)\n" +
+			"\n" +
+			"Configuration register is 0x2102\n"},
+		"show ip interface brief": {Output: "Interface                  IP-Address      OK? Method Status                Protocol\n" +
+			"GigabitEthernet0/0         192.0.2.1       YES NVRAM  up                    up\n" +
+			"GigabitEthernet0/1         198.51.100.1    YES NVRAM  up                    up\n" +
+			"GigabitEthernet0/2         unassigned      YES NVRAM  administratively down down\n"},
+	},
+}
+
+// PersonalityJuniperJunos emulates Juniper router with Junos operational mode cli
+var PersonalityJuniperJunos = &Personality{
+	Name:              "juniper-junos",
+	ServerVersion:     "SSH-2.0-OpenSSH_7.5",
+	Prompt:            "{user}@router> ",
+	PagerPrompt:       "---(more)---",
+	PageLines:         24,
+	PagingOffCommands: []string{"set cli screen-length 0"},
+	UnknownCommand:    "                     ^\nunknown command.\n",
+	Commands: map[string]PersonalityCommand{
+		"set cli screen-length 0": {Output: "Screen length set to 0\n"},
+		"show version": {Output: "Hostname: router\n" +
+			"Model: mx104\n" +
+			"Junos: 18.2R3-S3\n" +
+			"JUNOS OS Kernel 64-bit  [20191211.6a3d9d5_builder_stable_11]\n" +
+			"JUNOS OS libs [20191211.6a3d9d5_builder_stable_11]\n" +
+			"JUNOS OS runtime [20191211.6a3d9d5_builder_stable_11]\n"},
+		"show interfaces terse": {Output: "Interface               Admin Link Proto    Local                 Remote\n" +
+			"ge-0/0/0                up    up\n" +
+			"ge-0/0/0.0              up    up   inet     192.0.2.1/24\n" +
+			"ge-0/0/1                up    down\n" +
+			"lo0                     up    up\n" +
+			"lo0.0                   up    up   inet     10.255.255.1        --> 0/0\n"},
+	},
+}
+
+// PersonalityMikroTikRouterOS emulates MikroTik router with RouterOS cli
+var PersonalityMikroTikRouterOS = &Personality{
+	Name:           "mikrotik-routeros",
+	ServerVersion:  "SSH-2.0-ROSSSH",
+	Prompt:         "[{user}@MikroTik] > ",
+	ExitCommands:   []string{"/quit", "quit"},
+	UnknownCommand: "bad command name {command} (line 1 column 1)\n",
+	Commands: map[string]PersonalityCommand{
+		"/system identity print": {Output: "  name: MikroTik\n"},
+		"/system resource print": {Output: "                   uptime: 1w2d3h4m5s\n" +
+			"                  version: 6.45.9 (long-term)\n" +
+			"               build-time: May/22/2020 07:04:27\n" +
+			"              free-memory: 98.6MiB\n" +
+			"             total-memory: 128.0MiB\n" +
+			"                      cpu: MIPS 1004Kc V2.15\n" +
+			"                cpu-count: 4\n" +
+			"                 cpu-load: 1%\n" +
+			"           architecture-name: mmips\n" +
+			"               board-name: hEX\n" +
+			"                 platform: MikroTik\n"},
+	},
+}
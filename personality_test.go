@@ -0,0 +1,120 @@
+package sshtest
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestServer_SetPersonality(t *testing.T) {
+	server := NewMockedServer()
+	server.ServerConfig.NoClientAuth = true
+	server.SetPersonality(PersonalityCiscoIOS15)
+
+	host, port, err := server.Start()
+	require.NoError(t, err)
+
+	client := NewTestClient()
+	clientConn, err := ssh.Dial("tcp", fmt.Sprintf("%s:%d", host, port), client.ClientConfig)
+	require.NoError(t, err)
+	require.Equal(t, PersonalityCiscoIOS15.ServerVersion, string(clientConn.ServerVersion()))
+
+	session, err := clientConn.NewSession()
+	require.NoError(t, err)
+	output, err := session.Output("show version")
+	require.NoError(t, err)
+	require.Equal(t, PersonalityCiscoIOS15.Commands["show version"].Output, string(output))
+	_ = clientConn.Close()
+
+	// algorithms of previous personality are not kept
+	require.NotEmpty(t, server.KeyExchanges)
+	server.SetPersonality(&Personality{Name: "plain"})
+	require.Nil(t, server.KeyExchanges)
+	require.Nil(t, server.Ciphers)
+	require.Nil(t, server.MACs)
+	require.Equal(t, ServerVersion, server.ServerVersion)
+
+	server.Stop()
+	server.Wait()
+}
+
+func TestPersonality_Shell(t *testing.T) {
+	p := &Personality{
+		Name:              "test",
+		Prompt:            "{user}@test> ",
+		PagerPrompt:       "--More--",
+		PageLines:         2,
+		PagingOffCommands: []string{"nopage"},
+		UnknownCommand:    "unknown {command}\n",
+		Commands: map[string]PersonalityCommand{
+			"lines":  {Output: "1\n2\n3\n4\n5\n"},
+			"nopage": {},
+		},
+	}
+	server := NewMockedServer()
+	server.ServerConfig.NoClientAuth = true
+	server.SetPersonality(p)
+
+	host, port, err := server.Start()
+	require.NoError(t, err)
+
+	client := NewTestClient()
+	clientConn, err := ssh.Dial("tcp", fmt.Sprintf("%s:%d", host, port), client.ClientConfig)
+	require.NoError(t, err)
+	session, err := clientConn.NewSession()
+	require.NoError(t, err)
+
+	stdin, err := session.StdinPipe()
+	require.NoError(t, err)
+	stdout := new(bytes.Buffer)
+	session.Stdout = stdout
+	require.NoError(t, session.Shell())
+
+	// space shows next page, "q" stops output
+	_, err = io.WriteString(stdin, "foo\nlines\n q\nnopage\nlines\nexit\n")
+	require.NoError(t, err)
+	require.NoError(t, session.Wait())
+	_ = clientConn.Close()
+
+	erase := "\r" + strings.Repeat(" ", len(p.PagerPrompt)) + "\r"
+	require.Equal(t, "user1@test> unknown foo\r\n"+
+		"user1@test> 1\r\n2\r\n--More--"+erase+"3\r\n4\r\n--More--"+erase+
+		"user1@test> "+
+		"user1@test> "+
+		"user1@test> 1\r\n2\r\n3\r\n4\r\n5\r\n"+
+		"user1@test> ", stdout.String())
+
+	server.Stop()
+	server.Wait()
+}
+
+func TestLoadPersonality(t *testing.T) {
+	dir, err := os.MkdirTemp("", "sshtest")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "my-device.json")
+	require.NoError(t, SavePersonality(path, PersonalityJuniperJunos))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "broken.txt"), []byte("{"), 0644))
+
+	p, err := LoadPersonality(path)
+	require.NoError(t, err)
+	require.Equal(t, PersonalityJuniperJunos, p)
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"prompt": "> ", "commands": {"ping": {"output": "pong"}}}`), 0644))
+	require.NoError(t, LoadPersonalities(dir))
+	p, ok := GetPersonality("my-device")
+	require.True(t, ok)
+	require.Equal(t, "> ", p.Prompt)
+	require.Equal(t, "pong", p.Commands["ping"].Output)
+
+	_, ok = GetPersonality(PersonalityMikroTikRouterOS.Name)
+	require.True(t, ok)
+}
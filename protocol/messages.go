@@ -18,29 +18,29 @@ const (
 // RFC 4254 Section 6.2 Requesting a Pseudo-Terminal
 // type: "pty-req"
 type MsgRequestPTY struct {
-	Term     string
-	Columns  uint32
-	Rows     uint32
-	Width    uint32
-	Height   uint32
-	Modelist string
+	Term     string `json:"term"`
+	Columns  uint32 `json:"columns"`
+	Rows     uint32 `json:"rows"`
+	Width    uint32 `json:"width"`
+	Height   uint32 `json:"height"`
+	Modelist string `json:"modelist"`
 }
 
 // RFC 4254 Section 6.3.1 Requesting X11 Forwarding
 // type: "x11-req"
 type MsgRequestX11Forward struct {
-	Single       bool
-	AuthProtocol string
-	AuthCookie   string
-	ScreenNumber uint32
+	Single       bool   `json:"single"`
+	AuthProtocol string `json:"auth_protocol"`
+	AuthCookie   string `json:"auth_cookie"`
+	ScreenNumber uint32 `json:"screen_number"`
 }
 
 // RFC 4254 Section 6.4 Environment Variable Passing
 // type: "env"
 // Environment variables
 type MsgRequestSetEnv struct {
-	Name  string
-	Value string
+	Name  string `json:"name"`
+	Value string `json:"value"`
 }
 
 // RFC 4254 Section 6.5 Starting a Shell or a Command
@@ -48,7 +48,7 @@ type MsgRequestSetEnv struct {
 //   This message will request that the server start the execution of the
 // given command.
 type MsgRequestExec struct {
-	Command string
+	Command string `json:"command"`
 }
 
 // RFC 4254 Section 6.5 Starting a Shell or a Command
@@ -61,76 +61,76 @@ type MsgRequestShell struct{}
 // type: "subsystem"
 // Predefined subsystem
 type MsgRequestSubsystem struct {
-	Name string
+	Name string `json:"name"`
 }
 
 // RFC 4254 Section 6.7 Window Dimension Change Message
 // type: "window-change"
 type MsgRequestPTYWindowChange struct {
-	Columns uint32
-	Rows    uint32
-	Width   uint32
-	Height  uint32
+	Columns uint32 `json:"columns"`
+	Rows    uint32 `json:"rows"`
+	Width   uint32 `json:"width"`
+	Height  uint32 `json:"height"`
 }
 
 // RFC 4254 Section 6.9 Signals
 // type: "signal"
 type MsgSignal struct {
 	// signal name (without the "SIG" prefix)
-	Signal string
+	Signal string `json:"signal"`
 }
 
 // RFC 4254 Section 6.10 Returning Exit Status
 // type: "exit-status"
 type MsgExitStatus struct {
-	ExitStatus uint32
+	ExitStatus uint32 `json:"exit_status"`
 }
 
 // RFC 4254 Section 6.10 Returning Exit Status
 // type: "exit-signal"
 type MsgExitSignal struct {
 	// signal name (without the "SIG" prefix)
-	Signal     string
-	CoreDumped bool
-	Error      string
-	Lang       string
+	Signal     string `json:"signal"`
+	CoreDumped bool   `json:"core_dumped"`
+	Error      string `json:"error"`
+	Lang       string `json:"lang"`
 }
 
 // RFC 4254 Section 7.1 Requesting Port Forwarding
 // type: "tcpip-forward"
 type MsgRequestPortForward struct {
-	Address string
-	Port    uint32
+	Address string `json:"address"`
+	Port    uint32 `json:"port"`
 }
 
 // RFC 4254 Section 7.1 Requesting Port Forwarding
 // type: "cancel-tcpip-forward"
 type MsgRequestCancelPortForward struct {
-	Address string
-	Port    uint32
+	Address string `json:"address"`
+	Port    uint32 `json:"port"`
 }
 
 // RFC 4254 Section 7.2 TCP/IP Forwarding Channels
 // type: "forwarded-tcpip"
 type MsgChannelOpenForwarded struct {
-	RAddr string
-	RPort uint32
-	LAddr string
-	LPort uint32
+	RAddr string `json:"remote_addr"`
+	RPort uint32 `json:"remote_port"`
+	LAddr string `json:"local_addr"`
+	LPort uint32 `json:"local_port"`
 }
 
 // RFC 4254 Section 7.2 TCP/IP Forwarding Channels
 // type: "direct-tcpip"
 type MsgChannelOpenDirect struct {
-	RAddr string
-	RPort uint32
-	LAddr string
-	LPort uint32
+	RAddr string `json:"remote_addr"`
+	RPort uint32 `json:"remote_port"`
+	LAddr string `json:"local_addr"`
+	LPort uint32 `json:"local_port"`
 }
 
 type MsgUnparsed struct {
-	Type    string
-	Payload []byte
+	Type    string `json:"type"`
+	Payload []byte `json:"payload"`
 }
 
 func NewUnparsedMsg(msgType string, payload []byte) *MsgUnparsed {
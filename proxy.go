@@ -0,0 +1,313 @@
+package sshtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/craftyhunter/go-sshtest/protocol"
+)
+
+// Fixture is a set of exec results recorded from upstream server by Proxy
+type Fixture struct {
+	Execs []FixtureExec `json:"execs"`
+}
+
+// FixtureExec is a recorded result of exec request
+type FixtureExec struct {
+	Command    string `json:"command"`
+	Stdout     string `json:"stdout"`
+	Stderr     string `json:"stderr,omitempty"`
+	ExitStatus uint32 `json:"exit_status"`
+	// encoded as a duration string like "10ms"
+	Duration time.Duration `json:"duration"`
+}
+
+type fixtureExecJSON struct {
+	Command    string `json:"command"`
+	Stdout     string `json:"stdout"`
+	Stderr     string `json:"stderr,omitempty"`
+	ExitStatus uint32 `json:"exit_status"`
+	Duration   string `json:"duration"`
+}
+
+// MarshalJSON encodes duration as a string like "10ms", the same way as delays of the admin API
+func (e FixtureExec) MarshalJSON() ([]byte, error) {
+	return json.Marshal(fixtureExecJSON{
+		Command:    e.Command,
+		Stdout:     e.Stdout,
+		Stderr:     e.Stderr,
+		ExitStatus: e.ExitStatus,
+		Duration:   e.Duration.String(),
+	})
+}
+
+// UnmarshalJSON decodes duration from a string like "10ms"
+func (e *FixtureExec) UnmarshalJSON(data []byte) error {
+	var v fixtureExecJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	var duration time.Duration
+	if v.Duration != "" {
+		var err error
+		if duration, err = time.ParseDuration(v.Duration); err != nil {
+			return fmt.Errorf("wrong duration of %q: %s", v.Command, err)
+		}
+	}
+	*e = FixtureExec{
+		Command:    v.Command,
+		Stdout:     v.Stdout,
+		Stderr:     v.Stderr,
+		ExitStatus: v.ExitStatus,
+		Duration:   duration,
+	}
+	return nil
+}
+
+// LoadFixture reads fixture from json file
+func LoadFixture(path string) (*Fixture, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	f := new(Fixture)
+	if err = json.Unmarshal(data, f); err != nil {
+		return nil, fmt.Errorf("wrong fixture file %s: %s", path, err)
+	}
+	return f, nil
+}
+
+// Save writes fixture to json file
+func (f *Fixture) Save(path string) error {
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, os.FileMode(0644))
+}
+
+// ReplayFixture mocks exec results recorded in fixture.
+// When command was recorded several times, the last result is used.
+// Recorded durations are replayed as delays if withDelays is true.
+func (m *MockData) ReplayFixture(f *Fixture, withDelays bool) {
+	for _, e := range f.Execs {
+		result := ExecResult{Stdout: e.Stdout, Stderr: e.Stderr, ExitStatus: e.ExitStatus}
+		if withDelays {
+			result.Delay = e.Duration
+		}
+		m.MockExec(e.Command, result)
+	}
+}
+
+// Proxy forwards exec, shell and subsystem requests to upstream ssh server and records exec results into fixture.
+// Pty and env requests of the channel are forwarded before them, other requests like window-change and signal
+// aren't forwarded. Exit status of forwarded subsystem is always 0.
+type Proxy struct {
+	addr   string
+	config *ssh.ClientConfig
+
+	mu      sync.Mutex
+	client  *ssh.Client
+	fixture Fixture
+}
+
+// NewProxy creates proxy to upstream server at addr, config is used to authenticate on it
+func NewProxy(addr string, config *ssh.ClientConfig) *Proxy {
+	return &Proxy{
+		addr:   addr,
+		config: config,
+	}
+}
+
+// Fixture returns copy of recorded exec results
+func (p *Proxy) Fixture() *Fixture {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return &Fixture{Execs: append([]FixtureExec{}, p.fixture.Execs...)}
+}
+
+// Save writes recorded exec results to json file
+func (p *Proxy) Save(path string) error {
+	return p.Fixture().Save(path)
+}
+
+// Close closes connection to upstream server
+func (p *Proxy) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.client == nil {
+		return nil
+	}
+	err := p.client.Close()
+	p.client = nil
+	return err
+}
+
+// getClient returns upstream connection, new connection is logged to logger of channel which needs it
+func (p *Proxy) getClient(logger *slog.Logger) (*ssh.Client, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.client != nil {
+		return p.client, nil
+	}
+	client, err := ssh.Dial("tcp", p.addr, p.config)
+	if err != nil {
+		return nil, err
+	}
+	logger.Debug("proxy connected to upstream", "upstream", p.addr)
+	p.client = client
+	return client, nil
+}
+
+// dropClient closes broken upstream connection, so the next exec reconnects
+func (p *Proxy) dropClient(client *ssh.Client) {
+	p.mu.Lock()
+	if p.client == client {
+		_ = p.client.Close()
+		p.client = nil
+	}
+	p.mu.Unlock()
+}
+
+func (p *Proxy) newSession(logger *slog.Logger) (*ssh.Session, error) {
+	client, err := p.getClient(logger)
+	if err != nil {
+		return nil, err
+	}
+	session, err := client.NewSession()
+	if err != nil {
+		// upstream connection could be closed, try again with new one
+		p.dropClient(client)
+		if client, err = p.getClient(logger); err != nil {
+			return nil, err
+		}
+		session, err = client.NewSession()
+	}
+	return session, err
+}
+
+// run starts program of request on upstream server streaming its input and output, exec result is recorded.
+// name is command of exec request and name of subsystem request.
+func (p *Proxy) run(logger *slog.Logger, request, name string, pty *protocol.MsgRequestPTY, env []*protocol.MsgRequestSetEnv,
+	stdin io.Reader, stdout, stderr io.Writer) (exitStatus uint32, err error) {
+	session, err := p.newSession(logger)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = session.Close()
+	}()
+
+	for _, e := range env {
+		// sshd accepts only variables allowed by AcceptEnv
+		_ = session.Setenv(e.Name, e.Value)
+	}
+	if pty != nil {
+		ok, err := session.SendRequest(protocol.MsgTypePTYReq, true, ssh.Marshal(pty))
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			return 0, errors.New("upstream rejected pty request")
+		}
+	}
+	if request == protocol.MsgTypeSubsystem {
+		return 0, proxySubsystem(session, name, stdin, stdout, stderr)
+	}
+	stdoutBuf, stderrBuf := new(bytes.Buffer), new(bytes.Buffer)
+	session.Stdout = io.MultiWriter(stdout, stdoutBuf)
+	session.Stderr = io.MultiWriter(stderr, stderrBuf)
+	stdinPipe, err := session.StdinPipe()
+	if err != nil {
+		return 0, err
+	}
+	go func() {
+		_, _ = io.Copy(stdinPipe, stdin)
+		_ = stdinPipe.Close()
+	}()
+
+	started := time.Now()
+	if request == protocol.MsgTypeShell {
+		err = session.Shell()
+	} else {
+		err = session.Start(name)
+	}
+	if err != nil {
+		return 0, err
+	}
+	err = session.Wait()
+	if exitErr, ok := err.(*ssh.ExitError); ok {
+		exitStatus = uint32(exitErr.ExitStatus())
+	} else if err != nil {
+		return 0, err
+	}
+	if request != protocol.MsgTypeExec {
+		return exitStatus, nil
+	}
+
+	p.mu.Lock()
+	p.fixture.Execs = append(p.fixture.Execs, FixtureExec{
+		Command:    name,
+		Stdout:     stdoutBuf.String(),
+		Stderr:     stderrBuf.String(),
+		ExitStatus: exitStatus,
+		Duration:   time.Since(started),
+	})
+	p.mu.Unlock()
+	return exitStatus, nil
+}
+
+// proxySubsystem streams data of subsystem on upstream session until its output is closed.
+// Session started by RequestSubsystem can't be waited for, so its exit status is not known.
+func proxySubsystem(session *ssh.Session, name string, stdin io.Reader, stdout, stderr io.Writer) error {
+	stdinPipe, err := session.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdoutPipe, err := session.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderrPipe, err := session.StderrPipe()
+	if err != nil {
+		return err
+	}
+	if err = session.RequestSubsystem(name); err != nil {
+		return err
+	}
+	go func() {
+		_, _ = io.Copy(stdinPipe, stdin)
+		_ = stdinPipe.Close()
+	}()
+	stderrCopied := make(chan struct{})
+	go func() {
+		_, _ = io.Copy(stderr, stderrPipe)
+		close(stderrCopied)
+	}()
+	_, err = io.Copy(stdout, stdoutPipe)
+	<-stderrCopied
+	return err
+}
+
+// runProxy forwards request to upstream server and closes the channel
+func (ch *Channel) runProxy(p *Proxy, request, name string) {
+	defer func() {
+		_ = ch.Close()
+	}()
+	exitStatus, err := p.run(ch.logger, request, name, ch.getPTY(), ch.env(), ch.input, ch, ch.Stderr())
+	if err != nil {
+		ch.logger.Warn("proxy could not run request", "request", request, "name", name, "upstream", p.addr, "error", err)
+		_, _ = ch.Stderr().Write([]byte(fmt.Sprintf("sshtest proxy: %s\n", err)))
+		exitStatus = 255
+	}
+	_, _ = ch.SendRequest(protocol.MsgTypeExitStatus, false, ssh.Marshal(&protocol.MsgExitStatus{ExitStatus: exitStatus}))
+}
@@ -0,0 +1,148 @@
+package sshtest
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func runTestCommand(t *testing.T, host string, port uint16, command string) (stdout, stderr string, err error) {
+	client := NewTestClient()
+	clientConn, err := ssh.Dial("tcp", fmt.Sprintf("%s:%d", host, port), client.ClientConfig)
+	require.NoError(t, err)
+	defer func() {
+		_ = clientConn.Close()
+	}()
+	session, err := clientConn.NewSession()
+	require.NoError(t, err)
+	stdoutBuf, stderrBuf := new(bytes.Buffer), new(bytes.Buffer)
+	session.Stdout = stdoutBuf
+	session.Stderr = stderrBuf
+	err = session.Run(command)
+	return stdoutBuf.String(), stderrBuf.String(), err
+}
+
+func TestServer_SetProxy(t *testing.T) {
+	upstream := NewMockedServer()
+	upstream.ServerConfig.NoClientAuth = true
+	upstream.MockExec("uname", ExecResult{Stdout: "Linux\n"})
+	upstream.MockExec("ls /root", ExecResult{Stderr: "ls: cannot open directory '/root': Permission denied\n", ExitStatus: 2})
+	upstreamHost, upstreamPort, err := upstream.Start()
+	require.NoError(t, err)
+
+	// record
+	proxy := NewProxy(fmt.Sprintf("%s:%d", upstreamHost, upstreamPort), NewTestClient().ClientConfig)
+	server := NewMockedServer()
+	server.ServerConfig.NoClientAuth = true
+	server.SetProxy(proxy)
+	host, port, err := server.Start()
+	require.NoError(t, err)
+
+	stdout, _, err := runTestCommand(t, host, port, "uname")
+	require.NoError(t, err)
+	require.Equal(t, "Linux\n", stdout)
+	_, stderr, err := runTestCommand(t, host, port, "ls /root")
+	require.IsType(t, &ssh.ExitError{}, err)
+	require.Equal(t, 2, err.(*ssh.ExitError).ExitStatus())
+	require.Equal(t, "ls: cannot open directory '/root': Permission denied\n", stderr)
+
+	path := filepath.Join(t.TempDir(), "fixture.json")
+	require.NoError(t, proxy.Save(path))
+	require.NoError(t, proxy.Close())
+	server.Stop()
+	server.Wait()
+	upstream.Stop()
+	upstream.Wait()
+
+	// replay
+	fixture, err := LoadFixture(path)
+	require.NoError(t, err)
+	require.Len(t, fixture.Execs, 2)
+	require.Equal(t, "uname", fixture.Execs[0].Command)
+
+	server = NewMockedServer()
+	server.ServerConfig.NoClientAuth = true
+	server.ReplayFixture(fixture, false)
+	host, port, err = server.Start()
+	require.NoError(t, err)
+
+	stdout, _, err = runTestCommand(t, host, port, "uname")
+	require.NoError(t, err)
+	require.Equal(t, "Linux\n", stdout)
+	_, stderr, err = runTestCommand(t, host, port, "ls /root")
+	require.IsType(t, &ssh.ExitError{}, err)
+	require.Equal(t, 2, err.(*ssh.ExitError).ExitStatus())
+	require.Equal(t, "ls: cannot open directory '/root': Permission denied\n", stderr)
+
+	server.Stop()
+	server.Wait()
+}
+
+func TestFixture_Duration(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fixture.json")
+	fixture := &Fixture{Execs: []FixtureExec{{Command: "uname", Stdout: "Linux\n", Duration: 10 * time.Millisecond}}}
+	require.NoError(t, fixture.Save(path))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Contains(t, string(data), `"duration": "10ms"`)
+
+	loaded, err := LoadFixture(path)
+	require.NoError(t, err)
+	require.Equal(t, fixture, loaded)
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"execs": [{"command": "uname", "duration": "ten"}]}`), 0644))
+	_, err = LoadFixture(path)
+	require.Error(t, err)
+}
+
+func TestServer_SetProxyShellAndSubsystem(t *testing.T) {
+	upstream := NewTestServer(t, WithNoClientAuth(), WithPersonality(&Personality{
+		Name:     "upstream",
+		Prompt:   "> ",
+		Commands: map[string]PersonalityCommand{"hostname": {Output: "upstream\n"}},
+	}))
+	upstream.MockSubsystem("netconf", ExecResult{Stdout: "<hello/>"})
+	proxy := NewProxy(upstream.Addr(), NewTestClient().ClientConfig)
+	defer proxy.Close()
+	server := NewTestServer(t, WithNoClientAuth())
+	server.SetProxy(proxy)
+
+	clientConn, err := server.Dial("admin")
+	require.NoError(t, err)
+	defer clientConn.Close()
+
+	session, err := clientConn.NewSession()
+	require.NoError(t, err)
+	require.NoError(t, session.RequestPty("xterm", 24, 80, ssh.TerminalModes{}))
+	session.Stdin = strings.NewReader("hostname\nexit\n")
+	stdout := new(bytes.Buffer)
+	session.Stdout = stdout
+	require.NoError(t, session.Shell())
+	require.NoError(t, session.Wait())
+	require.Contains(t, stdout.String(), "upstream\r\n")
+
+	session, err = clientConn.NewSession()
+	require.NoError(t, err)
+	output, err := session.StdoutPipe()
+	require.NoError(t, err)
+	input, err := session.StdinPipe()
+	require.NoError(t, err)
+	require.NoError(t, session.RequestSubsystem("netconf"))
+	require.NoError(t, input.Close())
+	data, err := io.ReadAll(output)
+	require.NoError(t, err)
+	require.Equal(t, "<hello/>", string(data))
+
+	// only exec results are recorded
+	require.Empty(t, proxy.Fixture().Execs)
+	pty := upstream.ServedConnections()[0].ServedChannels()[0].getPTY()
+	require.Equal(t, "xterm", pty.Term)
+}
@@ -0,0 +1,162 @@
+package sshtest
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/craftyhunter/go-sshtest/protocol"
+)
+
+// RecordingOptions enables recording of terminal sessions to files
+type RecordingOptions struct {
+	// directory for recordings, recording is disabled if empty
+	Dir string
+	// write asciicast v2 file (.cast)
+	Asciicast bool
+	// write ttyrec file (.ttyrec)
+	Ttyrec bool
+}
+
+// asciicast v2 header, see https://docs.asciinema.org/manual/asciicast/v2/
+type asciicastHeader struct {
+	Version   int               `json:"version"`
+	Width     uint32            `json:"width"`
+	Height    uint32            `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// terminalSession returns pty request and time of the first event
+// if channel is a terminal session: pty was requested and shell or command was started
+func (ch *Channel) terminalSession(transcript []TranscriptEvent) (pty *protocol.MsgRequestPTY, started time.Time, ok bool) {
+	for _, e := range transcript {
+		if e.Type != TranscriptRequest || e.Direction != DirectionIn {
+			continue
+		}
+		switch msg := e.Request.(type) {
+		case *protocol.MsgRequestPTY:
+			if pty == nil {
+				pty = msg
+				started = e.Time
+			}
+		case *protocol.MsgRequestShell, *protocol.MsgRequestExec:
+			ok = pty != nil
+		}
+	}
+	return
+}
+
+// WriteAsciicast writes output of terminal session in asciicast v2 format
+func (ch *Channel) WriteAsciicast(w io.Writer) error {
+	transcript := ch.Transcript()
+	pty, started, ok := ch.terminalSession(transcript)
+	if !ok {
+		return fmt.Errorf("channel is not a terminal session")
+	}
+
+	enc := json.NewEncoder(w)
+	header := asciicastHeader{
+		Version:   2,
+		Width:     pty.Columns,
+		Height:    pty.Rows,
+		Timestamp: started.Unix(),
+	}
+	if pty.Term != "" {
+		header.Env = map[string]string{"TERM": pty.Term}
+	}
+	if err := enc.Encode(header); err != nil {
+		return err
+	}
+
+	for _, e := range transcript {
+		offset := e.Time.Sub(started).Seconds()
+		var event []interface{}
+		switch e.Type {
+		case TranscriptStdout, TranscriptStderr:
+			event = []interface{}{offset, "o", string(e.Data)}
+		case TranscriptRequest:
+			if msg, ok := e.Request.(*protocol.MsgRequestPTYWindowChange); ok {
+				event = []interface{}{offset, "r", fmt.Sprintf("%dx%d", msg.Columns, msg.Rows)}
+			}
+		}
+		if event == nil {
+			continue
+		}
+		if err := enc.Encode(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteTtyrec writes output of terminal session in ttyrec format
+func (ch *Channel) WriteTtyrec(w io.Writer) error {
+	transcript := ch.Transcript()
+	if _, _, ok := ch.terminalSession(transcript); !ok {
+		return fmt.Errorf("channel is not a terminal session")
+	}
+
+	header := make([]byte, 12)
+	for _, e := range transcript {
+		if e.Type != TranscriptStdout && e.Type != TranscriptStderr {
+			continue
+		}
+		binary.LittleEndian.PutUint32(header[0:], uint32(e.Time.Unix()))
+		binary.LittleEndian.PutUint32(header[4:], uint32(e.Time.Nanosecond()/1000))
+		binary.LittleEndian.PutUint32(header[8:], uint32(len(e.Data)))
+		if _, err := w.Write(header); err != nil {
+			return err
+		}
+		if _, err := w.Write(e.Data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RecordingFiles returns paths of recordings of the channel
+func (ch *Channel) RecordingFiles() []string {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	return append([]string{}, ch.recordings...)
+}
+
+// saveRecordings writes recordings of terminal session according to options
+func (ch *Channel) saveRecordings(opts RecordingOptions) {
+	if opts.Dir == "" {
+		return
+	}
+	if _, _, ok := ch.terminalSession(ch.Transcript()); !ok {
+		return
+	}
+	if opts.Asciicast {
+		ch.saveRecording(opts.Dir, ".cast", ch.WriteAsciicast)
+	}
+	if opts.Ttyrec {
+		ch.saveRecording(opts.Dir, ".ttyrec", ch.WriteTtyrec)
+	}
+}
+
+func (ch *Channel) saveRecording(dir, ext string, write func(w io.Writer) error) {
+	f, err := os.CreateTemp(dir, "sshtest-session-*"+ext)
+	if err != nil {
+		ch.logger.Warn("could not create recording", "error", err)
+		return
+	}
+	err = write(f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		ch.logger.Warn("could not write recording", "file", f.Name(), "error", err)
+		return
+	}
+	ch.logger.Debug("channel recorded", "file", f.Name())
+	ch.mu.Lock()
+	ch.recordings = append(ch.recordings, f.Name())
+	ch.mu.Unlock()
+}
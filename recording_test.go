@@ -0,0 +1,97 @@
+package sshtest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestChannel_RecordingFiles(t *testing.T) {
+	dir := t.TempDir()
+	server := NewMockedServer()
+	server.ServerConfig.NoClientAuth = true
+	server.SetPersonality(&Personality{Prompt: "$ ", Commands: map[string]PersonalityCommand{"ls": {Output: "file\n"}}})
+	server.SetRecordingOptions(RecordingOptions{Dir: dir, Asciicast: true, Ttyrec: true})
+
+	host, port, err := server.Start()
+	require.NoError(t, err)
+
+	client := NewTestClient()
+	clientConn, err := ssh.Dial("tcp", fmt.Sprintf("%s:%d", host, port), client.ClientConfig)
+	require.NoError(t, err)
+
+	// session without pty is not recorded
+	session, err := clientConn.NewSession()
+	require.NoError(t, err)
+	_, err = session.Output("ls")
+	require.NoError(t, err)
+
+	session, err = clientConn.NewSession()
+	require.NoError(t, err)
+	require.NoError(t, session.RequestPty("xterm", 24, 80, ssh.TerminalModes{}))
+	stdin, err := session.StdinPipe()
+	require.NoError(t, err)
+	require.NoError(t, session.Shell())
+	require.NoError(t, session.WindowChange(30, 100))
+	_, err = io.WriteString(stdin, "ls\nexit\n")
+	require.NoError(t, err)
+	require.NoError(t, session.Wait())
+	_ = clientConn.Close()
+
+	server.Stop()
+	server.Wait()
+
+	channels := server.ServedConnections()[0].ServedChannels()
+	require.Empty(t, channels[0].RecordingFiles())
+	files := channels[1].RecordingFiles()
+	require.Len(t, files, 2)
+	require.Equal(t, dir, filepath.Dir(files[0]))
+
+	// asciicast
+	data, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	require.True(t, scanner.Scan())
+	header := asciicastHeader{}
+	require.NoError(t, json.Unmarshal(scanner.Bytes(), &header))
+	require.Equal(t, asciicastHeader{Version: 2, Width: 80, Height: 24, Timestamp: header.Timestamp, Env: map[string]string{"TERM": "xterm"}}, header)
+	output := ""
+	resized := false
+	for scanner.Scan() {
+		var event []interface{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &event))
+		require.Len(t, event, 3)
+		switch event[1] {
+		case "o":
+			output += event[2].(string)
+		case "r":
+			require.Equal(t, "100x30", event[2])
+			resized = true
+		}
+	}
+	require.True(t, resized)
+	require.True(t, strings.HasPrefix(output, "$ "))
+	require.Contains(t, output, "file\r\n$ ")
+
+	// ttyrec
+	data, err = os.ReadFile(files[1])
+	require.NoError(t, err)
+	output = ""
+	for len(data) > 0 {
+		require.True(t, len(data) >= 12)
+		size := binary.LittleEndian.Uint32(data[8:])
+		output += string(data[12 : 12+size])
+		data = data[12+size:]
+	}
+	require.Contains(t, output, "file\r\n$ ")
+}
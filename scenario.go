@@ -0,0 +1,274 @@
+package sshtest
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"gopkg.in/yaml.v3"
+
+	"github.com/craftyhunter/go-sshtest/protocol"
+)
+
+// Scenario describes whole mocked server, it is read from yaml or json file.
+// Relative paths in scenario are relative to the scenario file directory.
+type Scenario struct {
+	// listen address, "localhost:0" if empty
+	Listen string `yaml:"listen" json:"listen"`
+	// paths of private host keys in PEM format, new key is generated if empty
+	HostKeys []string `yaml:"host_keys" json:"host_keys"`
+	// name of registered personality or path of personality file
+	Personality string `yaml:"personality" json:"personality"`
+	// inline personality used for shell, it overrides Personality
+	Shell *Personality `yaml:"shell" json:"shell"`
+
+	// allow clients without authentication
+	NoClientAuth bool           `yaml:"no_client_auth" json:"no_client_auth"`
+	Users        []ScenarioUser `yaml:"users" json:"users"`
+
+	Exec       []ScenarioExec `yaml:"exec" json:"exec"`
+	Subsystems []ScenarioExec `yaml:"subsystems" json:"subsystems"`
+	// answer unmocked exec commands with "command not found" and report them by Verify
+	Strict bool `yaml:"strict" json:"strict"`
+
+	// requests expected by Verify, exec commands which match none of them are reported as unexpected
+	Expect []ScenarioExpectation `yaml:"expect" json:"expect"`
+
+	dir string
+}
+
+// ScenarioUser is a user credentials
+type ScenarioUser struct {
+	Name     string `yaml:"name" json:"name"`
+	Password string `yaml:"password" json:"password"`
+	// public keys in authorized_keys format
+	AuthorizedKeys []string `yaml:"authorized_keys" json:"authorized_keys"`
+	// path of authorized_keys file
+	AuthorizedKeysFile string `yaml:"authorized_keys_file" json:"authorized_keys_file"`
+}
+
+// ScenarioExec is a mocked result of command or subsystem
+type ScenarioExec struct {
+	// command for exec, name for subsystem
+	Command    string        `yaml:"command" json:"command"`
+	Name       string        `yaml:"name" json:"name"`
+	Stdout     string        `yaml:"stdout" json:"stdout"`
+	Stderr     string        `yaml:"stderr" json:"stderr"`
+	ExitStatus uint32        `yaml:"exit_status" json:"exit_status"`
+	Delay      time.Duration `yaml:"delay" json:"delay"`
+}
+
+// ScenarioExpectation is a request which client is expected to send
+type ScenarioExpectation struct {
+	// request type: "exec", "env", "pty-req", "shell" or "subsystem"
+	Request string `yaml:"request" json:"request"`
+	// command of exec, name of env or subsystem
+	Command string `yaml:"command" json:"command"`
+	Name    string `yaml:"name" json:"name"`
+	// value of env
+	Value string `yaml:"value" json:"value"`
+	// exact count of requests, at least one request is expected if 0
+	Times int `yaml:"times" json:"times"`
+}
+
+// ReadScenario reads scenario from yaml or json file
+func ReadScenario(path string) (*Scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	sc := new(Scenario)
+	// json is a subset of yaml
+	if err = yaml.Unmarshal(data, sc); err != nil {
+		return nil, fmt.Errorf("wrong scenario file %s: %s", path, err)
+	}
+	sc.dir = filepath.Dir(path)
+	return sc, nil
+}
+
+// LoadScenario reads scenario from yaml or json file and creates server described by it
+func LoadScenario(path string) (*Server, error) {
+	sc, err := ReadScenario(path)
+	if err != nil {
+		return nil, err
+	}
+	return sc.NewServer()
+}
+
+func (sc *Scenario) path(path string) string {
+	if filepath.IsAbs(path) || sc.dir == "" {
+		return path
+	}
+	return filepath.Join(sc.dir, path)
+}
+
+// NewServer creates server described by scenario
+func (sc *Scenario) NewServer() (*Server, error) {
+	listen := sc.Listen
+	if listen == "" {
+		listen = "localhost:0"
+	}
+
+	var server *Server
+	for _, path := range sc.HostKeys {
+		data, err := os.ReadFile(sc.path(path))
+		if err != nil {
+			return nil, err
+		}
+		signer, err := ssh.ParsePrivateKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("wrong host key %s: %s", path, err)
+		}
+		if server == nil {
+			server = NewServer(listen, signer)
+		} else {
+			server.AddHostKey(signer)
+		}
+	}
+	if server == nil {
+		server = NewMockedServer()
+		server.listenAddr = listen
+	}
+
+	if err := sc.Apply(server); err != nil {
+		return nil, err
+	}
+	return server, nil
+}
+
+// Apply sets up personality, users and mocks of scenario on server
+func (sc *Scenario) Apply(server *Server) error {
+	var p *Personality
+	if sc.Personality != "" {
+		var ok bool
+		if p, ok = GetPersonality(sc.Personality); !ok {
+			var err error
+			if p, err = LoadPersonality(sc.path(sc.Personality)); err != nil {
+				return fmt.Errorf("unknown personality '%s': %s", sc.Personality, err)
+			}
+		}
+	}
+	if sc.Shell != nil {
+		// inline shell keeps version and algorithms of personality it doesn't set
+		shell := *sc.Shell
+		if p != nil {
+			if shell.ServerVersion == "" {
+				shell.ServerVersion = p.ServerVersion
+			}
+			if len(shell.KeyExchanges) == 0 {
+				shell.KeyExchanges = p.KeyExchanges
+			}
+			if len(shell.Ciphers) == 0 {
+				shell.Ciphers = p.Ciphers
+			}
+			if len(shell.MACs) == 0 {
+				shell.MACs = p.MACs
+			}
+		}
+		p = &shell
+	}
+	if p != nil {
+		server.SetPersonality(p)
+	}
+
+	if sc.NoClientAuth {
+		server.NoClientAuth = true
+	}
+	for _, u := range sc.Users {
+		if err := sc.applyUser(server, u); err != nil {
+			return err
+		}
+	}
+
+	for _, e := range sc.Exec {
+		server.MockExec(e.Command, e.result())
+	}
+	for _, e := range sc.Subsystems {
+		name := e.Name
+		if name == "" {
+			name = e.Command
+		}
+		server.MockSubsystem(name, e.result())
+	}
+	if sc.Strict {
+		server.SetExecFallback(ExecFallbackStrict)
+	}
+	for _, e := range sc.Expect {
+		if err := e.apply(server); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// apply adds expectation to server expectations
+func (e ScenarioExpectation) apply(server *Server) error {
+	var exp *Expectation
+	switch e.Request {
+	case protocol.MsgTypeExec:
+		exp = server.Expect().Exec(e.Command)
+	case protocol.MsgTypeEnv:
+		exp = server.Expect().Env(e.Name, e.Value)
+	case protocol.MsgTypePTYReq:
+		exp = server.Expect().PTY()
+	case protocol.MsgTypeShell:
+		exp = server.Expect().Shell()
+	case protocol.MsgTypeSubsystem:
+		exp = server.Expect().Subsystem(e.Name)
+	default:
+		return fmt.Errorf("unknown expected request '%s'", e.Request)
+	}
+	if e.Times > 0 {
+		exp.Times(e.Times)
+	} else {
+		exp.AtLeast(1)
+	}
+	return nil
+}
+
+func (sc *Scenario) applyUser(server *Server, u ScenarioUser) error {
+	if u.Password != "" {
+		server.AddUserPassword(u.Name, u.Password)
+	}
+	keys := append([]string{}, u.AuthorizedKeys...)
+	if u.AuthorizedKeysFile != "" {
+		data, err := os.ReadFile(sc.path(u.AuthorizedKeysFile))
+		if err != nil {
+			return err
+		}
+		keys = append(keys, strings.Split(string(data), "\n")...)
+	}
+	for _, line := range keys {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(line))
+		if err != nil {
+			return fmt.Errorf("wrong authorized key of user '%s': %s", u.Name, err)
+		}
+		server.AddUserAuthorizedKey(u.Name, key)
+	}
+	return nil
+}
+
+func (e ScenarioExec) result() ExecResult {
+	return ExecResult{
+		Stdout:     e.Stdout,
+		Stderr:     e.Stderr,
+		ExitStatus: e.ExitStatus,
+		Delay:      e.Delay,
+	}
+}
+
+// Verify checks that requests expected by scenario were served by server,
+// no unexpected commands were received and no unmocked commands were received in strict mode
+func (sc *Scenario) Verify(server *Server) error {
+	if err := server.VerifyExpectations(); err != nil {
+		return fmt.Errorf("unmet scenario expectations:\n%s", err)
+	}
+	return nil
+}
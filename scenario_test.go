@@ -0,0 +1,141 @@
+package sshtest
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+const testScenario = `
+listen: localhost:0
+host_keys: [host_key]
+personality: cisco-ios-15
+users:
+  - name: admin
+    password: secret
+  - name: deploy
+    authorized_keys_file: authorized_keys
+exec:
+  - command: uptime
+    stdout: " 10:00:00 up 1 day\n"
+  - command: cat /etc/shadow
+    stderr: "Permission denied\n"
+    exit_status: 1
+    delay: 10ms
+subsystems:
+  - name: netconf
+    stdout: "<hello/>"
+expect:
+  - request: exec
+    command: uptime
+    times: 1
+  - request: env
+    name: LANG
+`
+
+func TestLoadScenario(t *testing.T) {
+	dir := t.TempDir()
+
+	_, hostKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	block, err := ssh.MarshalPrivateKey(hostKey, "")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "host_key"), pem.EncodeToMemory(block), 0600))
+	hostSigner, err := ssh.NewSignerFromKey(hostKey)
+	require.NoError(t, err)
+
+	clientKey, clientPublicKey := NewSSHKeyPair(2048)
+	clientSigner, err := ssh.NewSignerFromKey(clientKey)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "authorized_keys"), ssh.MarshalAuthorizedKey(clientPublicKey), 0600))
+
+	path := filepath.Join(dir, "scenario.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(testScenario), 0600))
+
+	sc, err := ReadScenario(path)
+	require.NoError(t, err)
+	server, err := sc.NewServer()
+	require.NoError(t, err)
+	require.Equal(t, PersonalityCiscoIOS15.ServerVersion, server.ServerVersion)
+	host, port, err := server.Start()
+	require.NoError(t, err)
+	addr := fmt.Sprintf("%s:%d", host, port)
+
+	config := &ssh.ClientConfig{
+		User:            "admin",
+		Auth:            []ssh.AuthMethod{ssh.Password("secret")},
+		HostKeyCallback: ssh.FixedHostKey(hostSigner.PublicKey()),
+	}
+	clientConn, err := ssh.Dial("tcp", addr, config)
+	require.NoError(t, err)
+	session, err := clientConn.NewSession()
+	require.NoError(t, err)
+	output, err := session.Output("uptime")
+	require.NoError(t, err)
+	require.Equal(t, " 10:00:00 up 1 day\n", string(output))
+
+	session, err = clientConn.NewSession()
+	require.NoError(t, err)
+	output, err = session.CombinedOutput("cat /etc/shadow")
+	require.IsType(t, &ssh.ExitError{}, err)
+	require.Equal(t, "Permission denied\n", string(output))
+
+	session, err = clientConn.NewSession()
+	require.NoError(t, err)
+	stdout, err := session.StdoutPipe()
+	require.NoError(t, err)
+	require.NoError(t, session.RequestSubsystem("netconf"))
+	data := make([]byte, 8)
+	_, err = stdout.Read(data)
+	require.NoError(t, err)
+	require.Equal(t, "<hello/>", string(data))
+
+	session, err = clientConn.NewSession()
+	require.NoError(t, err)
+	require.Error(t, session.RequestSubsystem("sftp"))
+	_ = clientConn.Close()
+
+	config.User = "deploy"
+	config.Auth = []ssh.AuthMethod{ssh.PublicKeys(clientSigner)}
+	clientConn, err = ssh.Dial("tcp", addr, config)
+	require.NoError(t, err)
+	_ = clientConn.Close()
+
+	config.Auth = []ssh.AuthMethod{ssh.Password("secret")}
+	_, err = ssh.Dial("tcp", addr, config)
+	require.Error(t, err)
+
+	err = sc.Verify(server)
+	require.Error(t, err)
+	require.Equal(t, "unmet scenario expectations:\nunexpected exec 'cat /etc/shadow'\nunmet expectation env 'LANG': expected at least 1 times, got 0", err.Error())
+
+	server.Stop()
+	server.Wait()
+}
+
+func TestLoadScenario_JSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scenario.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"no_client_auth": true, "strict": true, "exec": [{"command": "id", "stdout": "uid=0(root)\n"}]}`), 0600))
+
+	server, err := LoadScenario(path)
+	require.NoError(t, err)
+	require.True(t, server.NoClientAuth)
+	require.Equal(t, ExecFallbackStrict, server.execFallback)
+	out, ok := server.getExecResult("id")
+	require.True(t, ok)
+	require.Equal(t, "uid=0(root)\n", out.result)
+
+	_, err = LoadScenario(filepath.Join(t.TempDir(), "missing.yaml"))
+	require.Error(t, err)
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"expect": [{"request": "x11-req"}]}`), 0600))
+	_, err = LoadScenario(path)
+	require.EqualError(t, err, "unknown expected request 'x11-req'")
+}
@@ -1,9 +1,12 @@
 package sshtest
 
 import (
+	"context"
 	"crypto/rsa"
 	"fmt"
+	"log/slog"
 	"net"
+	"net/http"
 	"strconv"
 	"strings"
 	"sync"
@@ -16,6 +19,12 @@ const (
 	ServerVersion = "SSH-2.0-ServerMock 1.0"
 )
 
+// shutdownPollInterval is interval of closing idle connections while server is shutting down
+const shutdownPollInterval = 10 * time.Millisecond
+
+// shutdownHandlersTimeout is max time of waiting for handlers of connections closed on shutdown timeout
+const shutdownHandlersTimeout = time.Second
+
 type Server struct {
 	// ssh server config
 	*ssh.ServerConfig
@@ -28,9 +37,12 @@ type Server struct {
 
 	// server privateKey
 	privateKey *rsa.PrivateKey
+	// host keys added to ServerConfig
+	hostKeys []ssh.Signer
 
-	quit chan struct{}
-	wg   sync.WaitGroup
+	quit     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
 
 	*MockData
 
@@ -41,7 +53,29 @@ type Server struct {
 	// keys for authorize clients
 	authorizedKeys    []ssh.PublicKey
 	authorizedKeysMap map[string]struct{}
+	userKeysMap       map[string]map[string]struct{}
+	passwords         map[string]string
 	servedConnections []*Connection
+	// connections being handled, they are kept on Reset
+	activeConnections map[*Connection]struct{}
+	connectionsCount  int
+	faults            []*serverFault
+	networkConditions NetworkConditions
+	adminServers      []*http.Server
+	virtualHosts      []*Server
+
+	// logger of server, its connections and channels, virtual hosts inherit it
+	logger *slog.Logger
+	// logger with server address, set when server is started
+	serverLogger *slog.Logger
+	events       *events
+	metrics      *metrics
+}
+
+// serverFault is a fault with count of connections it was injected to
+type serverFault struct {
+	Fault
+	injected int
 }
 
 func NewMockedServer() (server *Server) {
@@ -59,46 +93,241 @@ func NewServer(listenAddr string, serverKey ssh.Signer) (server *Server) {
 			PublicKeyCallback: func(c ssh.ConnMetadata, pubKey ssh.PublicKey) (*ssh.Permissions, error) {
 				server.mu.Lock()
 				defer server.mu.Unlock()
-				if _, ok := server.authorizedKeysMap[string(pubKey.Marshal())]; ok {
+				_, ok := server.authorizedKeysMap[string(pubKey.Marshal())]
+				if !ok {
+					_, ok = server.userKeysMap[c.User()][string(pubKey.Marshal())]
+				}
+				if ok {
 					return &ssh.Permissions{
 						// Record the public key used for authentication.
 						Extensions: map[string]string{
-							"pubkey-fp": ssh.FingerprintSHA256(pubKey),
+							extAuthMethod: "publickey",
+							"pubkey-fp":   ssh.FingerprintSHA256(pubKey),
 						},
 					}, nil
 				}
 				return nil, fmt.Errorf("unknown public key for %q", c.User())
 			},
+			PasswordCallback: func(c ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+				server.mu.Lock()
+				defer server.mu.Unlock()
+				if expected, ok := server.passwords[c.User()]; ok && expected == string(password) {
+					return &ssh.Permissions{
+						Extensions: map[string]string{extAuthMethod: "password"},
+					}, nil
+				}
+				return nil, fmt.Errorf("wrong password for %q", c.User())
+			},
 		},
 		StopTimeout:       time.Second * 10,
 		authorizedKeysMap: make(map[string]struct{}),
+		userKeysMap:       make(map[string]map[string]struct{}),
+		passwords:         make(map[string]string),
+		activeConnections: make(map[*Connection]struct{}),
 		listenAddr:        listenAddr,
 		MockData:          NewMockData(),
 		quit:              make(chan struct{}),
+		logger:            defaultLogger,
+		events:            newEvents(),
+		metrics:           newMetrics(),
 	}
 
-	server.ServerConfig.AddHostKey(serverKey)
+	server.AddHostKey(serverKey)
 	return
 }
 
+// nextConnectionID returns sequence number of accepted connection
+func (s *Server) nextConnectionID() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.connectionsCount++
+	return s.connectionsCount
+}
+
 func (s *Server) appendConnection(conn *Connection) {
 	s.mu.Lock()
 	s.servedConnections = append(s.servedConnections, conn)
+	s.activeConnections[conn] = struct{}{}
 	s.mu.Unlock()
 }
 
+func (s *Server) removeActiveConnection(conn *Connection) {
+	s.mu.Lock()
+	delete(s.activeConnections, conn)
+	s.mu.Unlock()
+}
+
+func (s *Server) getActiveConnections() []*Connection {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	connections := make([]*Connection, 0, len(s.activeConnections))
+	for c := range s.activeConnections {
+		connections = append(connections, c)
+	}
+	return connections
+}
+
 func (s *Server) ServedConnections() []*Connection {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	return append([]*Connection{}, s.servedConnections...)
 }
 
+// Connection returns served connection by ID
+func (s *Server) Connection(id int) (*Connection, bool) {
+	for _, c := range s.ServedConnections() {
+		if c.ID == id {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+// Reset forgets served connections and removes mocks and faults.
+// Authorized keys, passwords and personality are kept.
+func (s *Server) Reset() {
+	s.mu.Lock()
+	s.servedConnections = nil
+	s.faults = nil
+	s.mu.Unlock()
+	s.MockData.ResetMocks()
+}
+
+// AddHostKey adds host key to server, it replaces existing key of the same type
+func (s *Server) AddHostKey(key ssh.Signer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, k := range s.hostKeys {
+		if k.PublicKey().Type() == key.PublicKey().Type() {
+			s.hostKeys[i] = key
+			s.ServerConfig.AddHostKey(key)
+			return
+		}
+	}
+	s.hostKeys = append(s.hostKeys, key)
+	s.ServerConfig.AddHostKey(key)
+}
+
+// HostKeys returns public host keys of server
+func (s *Server) HostKeys() []ssh.PublicKey {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]ssh.PublicKey, 0, len(s.hostKeys))
+	for _, k := range s.hostKeys {
+		keys = append(keys, k.PublicKey())
+	}
+	return keys
+}
+
 func (s *Server) AddAuthorizedKey(key ssh.PublicKey) {
 	s.mu.Lock()
-	debugf("added client authorized key: '%s'", key.Type())
 	s.authorizedKeys = append(s.authorizedKeys, key)
 	s.authorizedKeysMap[string(key.Marshal())] = struct{}{}
 	s.mu.Unlock()
+	s.getLogger().Debug("added authorized key", "key_type", key.Type())
+}
+
+// AddUserAuthorizedKey authorizes key for user only
+func (s *Server) AddUserAuthorizedKey(user string, key ssh.PublicKey) {
+	s.mu.Lock()
+	if s.userKeysMap[user] == nil {
+		s.userKeysMap[user] = make(map[string]struct{})
+	}
+	s.userKeysMap[user][string(key.Marshal())] = struct{}{}
+	s.mu.Unlock()
+	s.getLogger().Debug("added authorized key", "key_type", key.Type(), "user", user)
+}
+
+// RemoveAuthorizedKey revokes key authorized for any user
+func (s *Server) RemoveAuthorizedKey(key ssh.PublicKey) {
+	marshaled := string(key.Marshal())
+	s.mu.Lock()
+	keys := s.authorizedKeys[:0]
+	for _, k := range s.authorizedKeys {
+		if string(k.Marshal()) != marshaled {
+			keys = append(keys, k)
+		}
+	}
+	s.authorizedKeys = keys
+	delete(s.authorizedKeysMap, marshaled)
+	s.mu.Unlock()
+	s.getLogger().Debug("removed authorized key", "key_type", key.Type())
+}
+
+// RemoveUserAuthorizedKey revokes key authorized for user
+func (s *Server) RemoveUserAuthorizedKey(user string, key ssh.PublicKey) {
+	s.mu.Lock()
+	delete(s.userKeysMap[user], string(key.Marshal()))
+	s.mu.Unlock()
+	s.getLogger().Debug("removed authorized key", "key_type", key.Type(), "user", user)
+}
+
+// AddUserPassword allows user to authenticate with password
+func (s *Server) AddUserPassword(user, password string) {
+	s.mu.Lock()
+	s.passwords[user] = password
+	s.mu.Unlock()
+	s.getLogger().Debug("added password", "user", user)
+}
+
+// SetPersonality makes server look like a device described by personality:
+// version banner, algorithms, shell and canned command outputs.
+// Default version and algorithms are used for those not set by personality.
+func (s *Server) SetPersonality(p *Personality) {
+	s.mu.Lock()
+	s.ServerVersion = ServerVersion
+	if p.ServerVersion != "" {
+		s.ServerVersion = p.ServerVersion
+	}
+	// nil algorithms are defaults of ssh library
+	s.KeyExchanges = p.KeyExchanges
+	s.Ciphers = p.Ciphers
+	s.MACs = p.MACs
+	s.mu.Unlock()
+	s.MockData.setPersonality(p)
+	s.getLogger().Debug("personality set", "personality", p.Name)
+}
+
+// AddFault injects fault into connections accepted after the call
+func (s *Server) AddFault(fault Fault) {
+	s.mu.Lock()
+	s.faults = append(s.faults, &serverFault{Fault: fault})
+	s.mu.Unlock()
+}
+
+// ResetFaults removes all added faults
+func (s *Server) ResetFaults() {
+	s.mu.Lock()
+	s.faults = nil
+	s.mu.Unlock()
+}
+
+// SetNetworkConditions sets simulated network conditions of all current and future connections
+func (s *Server) SetNetworkConditions(conditions NetworkConditions) {
+	s.mu.Lock()
+	s.networkConditions = conditions
+	s.mu.Unlock()
+	for _, c := range s.ServedConnections() {
+		c.SetNetworkConditions(conditions)
+	}
+}
+
+func (s *Server) getNetworkConditions() NetworkConditions {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.networkConditions
+}
+
+func (s *Server) faultsForConnection() (faults []Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, f := range s.faults {
+		if f.Connections == 0 || f.injected < f.Connections {
+			f.injected++
+			faults = append(faults, f.Fault)
+		}
+	}
+	return
 }
 
 func (s *Server) parseAssressPort(addressString string) (host string, port uint16, err error) {
@@ -115,64 +344,132 @@ func (s *Server) parseAssressPort(addressString string) (host string, port uint1
 	return
 }
 
+// Start starts server on listen address, it is tcp address or unix socket if address is "unix:/path/to/socket".
+// Port is zero for unix socket.
 func (s *Server) Start() (address string, port uint16, err error) {
-	s.listener, err = net.Listen("tcp", s.listenAddr)
+	listener, err := listen(s.listenAddr)
 	if err != nil {
 		return
 	}
-
-	debugf("server '%s' started on: '%s'", s.ServerVersion, s.listener.Addr().String())
-
-	s.wg.Add(1)
-	go s.serve()
-	return s.parseAssressPort(s.listener.Addr().String())
+	if err = s.StartListener(listener); err != nil {
+		return
+	}
+	if listener.Addr().Network() == "unix" {
+		return listener.Addr().String(), 0, nil
+	}
+	return s.parseAssressPort(listener.Addr().String())
 }
 
-func (s *Server) serve() {
+func (s *Server) serve(listener net.Listener) {
 	defer s.wg.Done()
 	for {
-		netConn, err := s.listener.Accept()
+		netConn, err := listener.Accept()
 		if err != nil {
 			select {
 			case <-s.quit:
 				return
 			default:
-				debugf("failed to accept incoming connection: %[1]T %[1]v", err)
+				s.getLogger().Warn("failed to accept incoming connection", "error", err)
 				return
 			}
 		}
+		s.serveConn(netConn)
+	}
+}
+
+func (s *Server) started() bool {
+	return s.getListener() != nil
+}
 
-		debugf("accepted new connection from %s", netConn.RemoteAddr().String())
-		conn := NewConnection(netConn, s.MockData)
-		s.appendConnection(conn)
+// Addr returns address of started server in "host:port" form
+func (s *Server) Addr() string {
+	listener := s.getListener()
+	if listener == nil {
+		return ""
+	}
+	return listener.Addr().String()
+}
 
-		s.wg.Add(1)
-		go func() {
-			conn.handle(s.ServerConfig)
-			s.wg.Done()
-		}()
+// StartContext starts server and stops it when ctx is done, see Stop
+func (s *Server) StartContext(ctx context.Context) (address string, port uint16, err error) {
+	if address, port, err = s.Start(); err != nil {
+		return
 	}
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.Stop()
+		case <-s.quit:
+		}
+	}()
+	return
 }
 
+// Stop shuts server down, clients are disconnected after StopTimeout.
+// It is safe to call Stop more than once.
 func (s *Server) Stop() {
-	debug("Stopping server ...")
-	close(s.quit)
-	_ = s.listener.Close()
-	clientsDisconnected := make(chan struct{})
+	s.mu.Lock()
+	timeout := s.StopTimeout
+	s.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	_ = s.Shutdown(ctx)
+}
+
+// Shutdown stops accepting connections, stops admin API and virtual hosts, closes idle connections
+// and waits for channels of other connections to finish. When ctx is done remaining connections are closed,
+// their handlers are waited for up to shutdownHandlersTimeout and ctx error is returned.
+// Authenticated clients receive SSH_MSG_DISCONNECT with the reason of close.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.stopOnce.Do(func() {
+		s.getLogger().Debug("stopping server")
+		s.mu.Lock()
+		close(s.quit)
+		s.mu.Unlock()
+		if listener := s.getListener(); listener != nil {
+			_ = listener.Close()
+		}
+		s.stopAdmin()
+	})
+	s.shutdownVirtualHosts(ctx)
+
+	handled := make(chan struct{})
 	go func() {
 		s.wg.Wait()
-		clientsDisconnected <- struct{}{}
+		close(handled)
 	}()
-	go func() {
-		time.Sleep(s.StopTimeout)
-		for _, c := range s.ServedConnections() {
-			debugf("Closing connection from %s ...", c.RemoteAddr().String())
-			_ = c.Close()
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for {
+		s.closeIdleConnections()
+		select {
+		case <-handled:
+			s.getLogger().Info("server stopped")
+			return nil
+		case <-ctx.Done():
+			for _, c := range s.getActiveConnections() {
+				c.logger.Debug("closing connection on stop timeout")
+				c.disconnect("server shutdown timeout")
+			}
+			select {
+			case <-handled:
+			case <-time.After(shutdownHandlersTimeout):
+				s.getLogger().Warn("connection handlers are not finished after stop timeout")
+			}
+			s.getLogger().Info("server stopped")
+			return ctx.Err()
+		case <-ticker.C:
 		}
-		clientsDisconnected <- struct{}{}
-	}()
-	<-clientsDisconnected
-	debug("Server stopped ...")
+	}
+}
+
+// closeIdleConnections closes connections without active channels
+func (s *Server) closeIdleConnections() {
+	for _, c := range s.getActiveConnections() {
+		if c.closeIdle("server shutdown") {
+			c.logger.Debug("closed idle connection on shutdown")
+		}
+	}
 }
 
 func (s *Server) Wait() {
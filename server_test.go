@@ -63,7 +63,8 @@ func TestNewServer(t *testing.T) {
 }
 
 func TestServer_AddAuthorizedKey(t *testing.T) {
-	signer, publicKey := NewSSHKeyPair(2048)
+	privateKey, publicKey := NewSSHKeyPair(2048)
+	signer, _ := ssh.NewSignerFromKey(privateKey)
 	server := NewMockedServer()
 	server.AddAuthorizedKey(publicKey)
 	host, port, err := server.Start()
@@ -76,7 +77,8 @@ func TestServer_AddAuthorizedKey(t *testing.T) {
 	err = client.Connect(host, port)
 	require.NoError(t, err)
 
-	signer2, _ := NewSSHKeyPair(2048)
+	privateKey2, _ := NewSSHKeyPair(2048)
+	signer2, _ := ssh.NewSignerFromKey(privateKey2)
 	client2 := NewTestClient()
 	client2.User = "user2"
 	client2.ClientConfig.Auth = []ssh.AuthMethod{ssh.PublicKeys(signer2)}
@@ -90,6 +92,27 @@ func TestServer_AddAuthorizedKey(t *testing.T) {
 	server.Wait()
 }
 
+func TestServer_RemoveAuthorizedKey(t *testing.T) {
+	privateKey, publicKey := NewSSHKeyPair(2048)
+	signer, _ := ssh.NewSignerFromKey(privateKey)
+	server := NewMockedServer()
+	server.AddAuthorizedKey(publicKey)
+	server.AddAuthorizedKey(publicKey)
+	server.RemoveAuthorizedKey(publicKey)
+	host, port, err := server.Start()
+	require.NoError(t, err)
+
+	client := NewTestClient()
+	client.ClientConfig.Auth = []ssh.AuthMethod{ssh.PublicKeys(signer)}
+	client.Command = "echo OK"
+	err = client.Connect(host, port)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "ssh: handshake failed: ssh: unable to authenticate")
+
+	server.Stop()
+	server.Wait()
+}
+
 func serverIsAlive(host string, port uint16) bool {
 	conn, err := net.DialTimeout("tcp", fmt.Sprintf("%s:%d", host, port), time.Millisecond*300)
 	if err != nil {
@@ -148,3 +171,30 @@ func (client *TestClient) Connect(host string, port uint16) (err error) {
 
 	return session.Wait()
 }
+
+func TestServer_MalformedRequests(t *testing.T) {
+	server := NewTestServer(t, WithNoClientAuth())
+	server.MockExec("", ExecResult{Stdout: "empty command"})
+	clientConn, err := server.Dial("admin")
+	require.NoError(t, err)
+	defer clientConn.Close()
+	session, err := clientConn.NewSession()
+	require.NoError(t, err)
+
+	for _, request := range []string{"pty-req", "window-change", "env", "exec", "subsystem"} {
+		ok, err := session.SendRequest(request, true, []byte{0, 0, 0, 9})
+		require.NoError(t, err)
+		require.False(t, ok, request)
+	}
+	output, err := session.Output("uptime")
+	require.NoError(t, err)
+	require.Empty(t, output)
+
+	channel := server.ServedConnections()[0].ServedChannels()[0]
+	requests := channel.Requests()
+	require.Len(t, requests, 6)
+	for _, r := range requests[:5] {
+		require.IsType(t, &protocol.MsgUnparsed{}, r)
+	}
+	require.Nil(t, channel.getPTY())
+}
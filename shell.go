@@ -0,0 +1,172 @@
+package sshtest
+
+import (
+	"bufio"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/craftyhunter/go-sshtest/protocol"
+)
+
+const (
+	keyCtrlC     = 0x03
+	keyCtrlD     = 0x04
+	keyBackspace = 0x08
+	keyDelete    = 0x7f
+)
+
+// shellSession emulates interactive cli of the device described by personality
+type shellSession struct {
+	ch          *Channel
+	personality *Personality
+	in          *bufio.Reader
+	echo        bool
+	pageLines   int
+	// last read byte was '\r', so following '\n' must be skipped
+	skipLF bool
+}
+
+func (ch *Channel) runShell(p *Personality) {
+	defer func() {
+		_ = ch.Close()
+	}()
+
+	shell := &shellSession{
+		ch:          ch,
+		personality: p,
+		in:          bufio.NewReader(ch.input),
+		echo:        ch.getPTY() != nil,
+		pageLines:   p.PageLines,
+	}
+	shell.run()
+	_, _ = ch.SendRequest(protocol.MsgTypeExitStatus, false, ssh.Marshal(&protocol.MsgExitStatus{ExitStatus: 0}))
+}
+
+func (s *shellSession) run() {
+	if s.personality.MOTD != "" {
+		s.write(s.personality.MOTD)
+	}
+	prompt := s.personality.prompt(s.ch.user())
+	for {
+		s.write(prompt)
+		line, err := s.readLine()
+		if err != nil {
+			s.ch.logger.Debug("shell finished", "error", err)
+			return
+		}
+		command := strings.TrimSpace(line)
+		if command == "" {
+			continue
+		}
+		s.ch.logger.Debug("shell received command", "command", command)
+		if s.personality.isExitCommand(command) {
+			return
+		}
+		if s.personality.isPagingOffCommand(command) {
+			s.pageLines = 0
+		}
+		if out, ok := s.ch.mockData.getExecResult(command); ok {
+			s.writePaged(out.result)
+		} else {
+			s.write(s.personality.unknownCommand(command))
+		}
+	}
+}
+
+// write sends text to the client with terminal line endings
+func (s *shellSession) write(text string) {
+	text = strings.Replace(text, "\r\n", "\n", -1)
+	_, _ = s.ch.Write([]byte(strings.Replace(text, "\n", "\r\n", -1)))
+}
+
+// readLine reads bytes until end of line, echoing them when client requested pty
+func (s *shellSession) readLine() (string, error) {
+	var line []byte
+	for {
+		b, err := s.readByte()
+		if err != nil {
+			return "", err
+		}
+		switch b {
+		case '\r', '\n':
+			if s.echo {
+				s.write("\n")
+			}
+			return string(line), nil
+		case keyCtrlD:
+			if len(line) == 0 {
+				return "", io.EOF
+			}
+		case keyCtrlC:
+			line = line[:0]
+			if s.echo {
+				s.write("^C\n")
+			}
+			return "", nil
+		case keyBackspace, keyDelete:
+			if len(line) > 0 {
+				line = line[:len(line)-1]
+				if s.echo {
+					_, _ = s.ch.Write([]byte("\b \b"))
+				}
+			}
+		default:
+			line = append(line, b)
+			if s.echo {
+				_, _ = s.ch.Write([]byte{b})
+			}
+		}
+	}
+}
+
+// readByte reads next input byte treating "\r\n" as a single '\r'
+func (s *shellSession) readByte() (byte, error) {
+	b, err := s.in.ReadByte()
+	if err == nil && s.skipLF && b == '\n' {
+		b, err = s.in.ReadByte()
+	}
+	s.skipLF = err == nil && b == '\r'
+	return b, err
+}
+
+// writePaged writes output page by page waiting for a key after each page:
+// space shows next page, enter shows next line, any other key stops output
+func (s *shellSession) writePaged(output string) {
+	lines := strings.SplitAfter(output, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if s.pageLines <= 0 || len(lines) <= s.pageLines {
+		s.write(output)
+		return
+	}
+
+	s.write(strings.Join(lines[:s.pageLines], ""))
+	lines = lines[s.pageLines:]
+	for len(lines) > 0 {
+		s.write(s.personality.PagerPrompt)
+		key, err := s.readByte()
+		// erase pager prompt
+		s.write("\r" + strings.Repeat(" ", len(s.personality.PagerPrompt)) + "\r")
+		if err != nil {
+			return
+		}
+
+		n := 0
+		switch key {
+		case ' ':
+			n = s.pageLines
+		case '\r', '\n':
+			n = 1
+		default:
+			return
+		}
+		if n > len(lines) {
+			n = len(lines)
+		}
+		s.write(strings.Join(lines[:n], ""))
+		lines = lines[n:]
+	}
+}
@@ -0,0 +1,109 @@
+package sshtest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestServer_Shutdown(t *testing.T) {
+	server := NewMockedServer()
+	server.NoClientAuth = true
+	server.MockExec("sleep", ExecResult{Stdout: "done", Delay: 200 * time.Millisecond})
+	_, _, err := server.Start()
+	require.NoError(t, err)
+
+	busy, err := server.Dial("admin")
+	require.NoError(t, err)
+	defer busy.Close()
+	idle, err := server.Dial("admin")
+	require.NoError(t, err)
+	defer idle.Close()
+	require.NoError(t, server.WaitForConnections(2, time.Second))
+
+	output := make(chan string, 1)
+	go func() {
+		session, err := busy.NewSession()
+		if err == nil {
+			out, _ := session.Output("sleep")
+			output <- string(out)
+		}
+	}()
+	_, err = server.WaitForExec("sleep", time.Second)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, server.Shutdown(ctx))
+	require.Equal(t, "done", <-output)
+	require.ErrorContains(t, idle.Wait(), "server shutdown")
+	c, _ := server.Connection(2)
+	require.Equal(t, "server shutdown", c.Stat().CloseReason)
+	c, _ = server.Connection(1)
+	require.Equal(t, "server shutdown", c.Stat().CloseReason)
+
+	_, err = server.Dial("admin")
+	require.Error(t, err)
+	// stop is idempotent
+	server.Stop()
+	server.Stop()
+}
+
+func TestServer_ShutdownTimeout(t *testing.T) {
+	server := NewMockedServer()
+	server.NoClientAuth = true
+	server.MockExec("sleep", ExecResult{Delay: time.Second})
+	_, _, err := server.Start()
+	require.NoError(t, err)
+
+	client, err := server.Dial("admin")
+	require.NoError(t, err)
+	defer client.Close()
+	session, err := client.NewSession()
+	require.NoError(t, err)
+	require.NoError(t, session.Start("sleep"))
+	require.NoError(t, server.WaitForConnections(1, time.Second))
+	c, _ := server.Connection(1)
+	// connections forgotten on reset are closed too
+	server.Reset()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, server.Shutdown(ctx), context.DeadlineExceeded)
+	require.Error(t, session.Wait())
+	require.ErrorContains(t, client.Wait(), "server shutdown timeout")
+	// handlers are finished when Shutdown returns
+	require.NoError(t, c.WaitClosed(time.Millisecond))
+	require.Equal(t, "server shutdown timeout", c.Stat().CloseReason)
+}
+
+func TestServer_StartContext(t *testing.T) {
+	server := NewMockedServer()
+	server.NoClientAuth = true
+	ctx, cancel := context.WithCancel(context.Background())
+	_, _, err := server.StartContext(ctx)
+	require.NoError(t, err)
+	client, err := server.Dial("admin")
+	require.NoError(t, err)
+
+	cancel()
+	require.Error(t, client.Wait())
+	stopped := make(chan struct{})
+	go func() {
+		server.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("server is not stopped")
+	}
+	_, err = server.Dial("admin", ssh.Password("secret"))
+	require.Error(t, err)
+
+	// server is never started
+	NewMockedServer().Stop()
+}
@@ -0,0 +1,59 @@
+package sshtest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestConnection_Stat(t *testing.T) {
+	server := NewTestServer(t, WithNoClientAuth())
+	server.MockExec("false", ExecResult{Stderr: "failed\n", ExitStatus: 1})
+	client := NewTestClient()
+
+	clientConn, err := ssh.Dial("tcp", server.Addr(), client.ClientConfig)
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		session, err := clientConn.NewSession()
+		require.NoError(t, err)
+		require.NoError(t, session.Setenv("LANG", "C"))
+		require.Error(t, session.Run("false"))
+	}
+	_, _, err = clientConn.OpenChannel("direct-tcpip", nil)
+	require.Error(t, err)
+	_ = clientConn.Close()
+
+	c, ok := server.Connection(1)
+	require.True(t, ok)
+	require.NoError(t, c.WaitClosed(time.Second))
+	stat := c.Stat()
+	require.False(t, stat.ConnectTime.IsZero())
+	require.True(t, stat.AuthTime.After(stat.ConnectTime))
+	require.False(t, stat.DisconnectTime.Before(stat.AuthTime))
+	require.Equal(t, stat.AuthTime.Sub(stat.ConnectTime), stat.HandshakeDuration)
+	require.Positive(t, stat.BytesIn)
+	require.Positive(t, stat.BytesOut)
+	require.Equal(t, 2, stat.Channels)
+	require.Equal(t, 1, stat.RejectedChannels)
+	require.Equal(t, map[string]int{"env": 2, "exec": 2}, stat.Requests)
+	require.Equal(t, "client disconnected", stat.CloseReason)
+
+	chStat := c.ServedChannels()[0].Stat()
+	require.False(t, chStat.CloseTime.Before(chStat.OpenTime))
+	require.Equal(t, map[string]int{"env": 1, "exec": 1}, chStat.Requests)
+	require.Equal(t, int64(len("failed\n")), chStat.BytesOut)
+	require.Equal(t, 1, chStat.ExitStatus)
+	require.Equal(t, "closed by server", chStat.CloseReason)
+
+	// kicked connection
+	clientConn, err = ssh.Dial("tcp", server.Addr(), client.ClientConfig)
+	require.NoError(t, err)
+	defer clientConn.Close()
+	require.NoError(t, server.WaitForConnections(2, time.Second))
+	c, _ = server.Connection(2)
+	_ = c.Close()
+	require.NoError(t, c.WaitClosed(time.Second))
+	require.Equal(t, "closed by server", c.Stat().CloseReason)
+}
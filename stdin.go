@@ -0,0 +1,108 @@
+package sshtest
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// StdinOptions limits recording of client data received on channels
+type StdinOptions struct {
+	// max bytes count kept in memory, unlimited if 0
+	MaxMemory int64
+	// directory for recorded data exceeding MaxMemory,
+	// data exceeding MaxMemory is dropped if empty.
+	// Files are not removed by server.
+	SpillDir string
+}
+
+// stdinRecorder records data read from client
+type stdinRecorder struct {
+	r    io.Reader
+	opts StdinOptions
+	// called for read data with its part kept in memory and for EOF
+	onRead func(kept []byte, size int, eof bool)
+	logger *slog.Logger
+
+	mu        sync.Mutex
+	buf       bytes.Buffer
+	file      *os.File
+	size      int64
+	truncated bool
+	eofTime   time.Time
+	err       error
+}
+
+func newStdinRecorder(r io.Reader, opts StdinOptions) *stdinRecorder {
+	return &stdinRecorder{r: r, opts: opts, logger: defaultLogger}
+}
+
+func (s *stdinRecorder) Read(p []byte) (n int, err error) {
+	n, err = s.r.Read(p)
+	s.mu.Lock()
+	kept := s.write(p[:n])
+	eof := err == io.EOF && s.eofTime.IsZero()
+	if eof {
+		s.eofTime = time.Now()
+	}
+	s.mu.Unlock()
+	if s.onRead != nil {
+		if n > 0 {
+			s.onRead(kept, n, false)
+		}
+		if eof {
+			s.onRead(nil, 0, true)
+		}
+	}
+	return
+}
+
+// write records data and returns its part kept in memory
+func (s *stdinRecorder) write(data []byte) []byte {
+	s.size += int64(len(data))
+	if s.file == nil && s.opts.MaxMemory > 0 && int64(s.buf.Len()+len(data)) > s.opts.MaxMemory {
+		if s.opts.SpillDir == "" {
+			data = data[:s.opts.MaxMemory-int64(s.buf.Len())]
+			s.truncated = true
+		} else if s.file, s.err = os.CreateTemp(s.opts.SpillDir, "sshtest-stdin-"); s.err == nil {
+			_, s.err = s.file.Write(s.buf.Bytes())
+			s.buf.Reset()
+		} else {
+			s.logger.Warn("could not spill stdin to disk", "error", s.err)
+			data = data[:s.opts.MaxMemory-int64(s.buf.Len())]
+			s.truncated = true
+		}
+	}
+	if s.file != nil {
+		if _, err := s.file.Write(data); err != nil && s.err == nil {
+			s.err = err
+		}
+		return nil
+	}
+	s.buf.Write(data)
+	return data
+}
+
+func (s *stdinRecorder) bytes() []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file != nil {
+		data, err := os.ReadFile(s.file.Name())
+		if err != nil {
+			s.logger.Warn("could not read spilled stdin", "error", err)
+		}
+		return data
+	}
+	return append([]byte{}, s.buf.Bytes()...)
+}
+
+func (s *stdinRecorder) close() {
+	s.mu.Lock()
+	if s.file != nil {
+		_ = s.file.Close()
+	}
+	s.mu.Unlock()
+}
@@ -0,0 +1,65 @@
+package sshtest
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestChannel_Stdin(t *testing.T) {
+	script := "#!/bin/bash\necho OK\n" + strings.Repeat("# comment\n", 10)
+	server := NewMockedServer()
+	server.ServerConfig.NoClientAuth = true
+	server.MockExecResult("bash -s", "OK\n", 0, 0)
+
+	host, port, err := server.Start()
+	require.NoError(t, err)
+
+	client := NewTestClient()
+	clientConn, err := ssh.Dial("tcp", fmt.Sprintf("%s:%d", host, port), client.ClientConfig)
+	require.NoError(t, err)
+
+	runScript := func() {
+		session, err := clientConn.NewSession()
+		require.NoError(t, err)
+		session.Stdin = strings.NewReader(script)
+		output, err := session.Output("bash -s")
+		require.NoError(t, err)
+		require.Equal(t, "OK\n", string(output))
+	}
+
+	runScript()
+	server.SetStdinOptions(StdinOptions{MaxMemory: 10})
+	runScript()
+	spillDir := t.TempDir()
+	server.SetStdinOptions(StdinOptions{MaxMemory: 10, SpillDir: spillDir})
+	runScript()
+	_ = clientConn.Close()
+
+	channels := server.ServedConnections()[0].ServedChannels()
+	require.Len(t, channels, 3)
+
+	require.Equal(t, script, string(channels[0].Stdin()))
+	require.Equal(t, int64(len(script)), channels[0].StdinSize())
+	require.Empty(t, channels[0].StdinFile())
+	require.False(t, channels[0].StdinTruncated())
+	require.False(t, channels[0].StdinEOFTime().IsZero())
+	require.False(t, channels[0].CloseTime().IsZero())
+	require.False(t, channels[0].CloseTime().Before(channels[0].StdinEOFTime()))
+
+	// data exceeding memory limit is dropped
+	require.Equal(t, script[:10], string(channels[1].Stdin()))
+	require.Equal(t, int64(len(script)), channels[1].StdinSize())
+	require.True(t, channels[1].StdinTruncated())
+
+	// or spilled to disk
+	require.Equal(t, script, string(channels[2].Stdin()))
+	require.Contains(t, channels[2].StdinFile(), spillDir)
+	require.False(t, channels[2].StdinTruncated())
+
+	server.Stop()
+	server.Wait()
+}
@@ -0,0 +1,47 @@
+package sshtest
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// NewTestServer creates mocked server with options and starts it, test fails if server cannot be started.
+// Log records of all levels are written to t.Logf unless WithLogger is set, server is stopped when the test and its subtests finish,
+// commands answered by ExecFallbackStrict fail the test, transcript of served connections is logged if the test failed.
+// Clients are disconnected after one second of stopping unless WithStopTimeout is set.
+func NewTestServer(t testing.TB, opts ...ServerOption) *Server {
+	t.Helper()
+	// t.Logf panics after the test is finished, so the flag is checked and set under the lock
+	var mu sync.Mutex
+	stopped := false
+	server := NewMockedServer()
+	server.StopTimeout = time.Second
+	server.logger = NewLogfLogger(func(format string, v ...interface{}) {
+		mu.Lock()
+		defer mu.Unlock()
+		if !stopped {
+			t.Logf(format, v...)
+		}
+	})
+	for _, opt := range opts {
+		opt(server)
+	}
+	if _, _, err := server.Start(); err != nil {
+		t.Fatalf("could not start ssh server: %s", err)
+	}
+	t.Cleanup(func() {
+		server.Stop()
+		mu.Lock()
+		stopped = true
+		mu.Unlock()
+		for _, miss := range server.strictMisses() {
+			t.Errorf("%s", miss)
+		}
+		if t.Failed() {
+			t.Logf("served connections:\n%s", strings.TrimRight(server.TranscriptString(), "\n"))
+		}
+	})
+	return server
+}
@@ -0,0 +1,108 @@
+package sshtest
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestNewTestServer(t *testing.T) {
+	server := NewTestServer(t, WithNoClientAuth(), WithUserPassword("admin", "secret"))
+	server.MockExec("uptime", ExecResult{Stdout: "up 1 day\n"})
+	require.NotEmpty(t, server.Addr())
+
+	client := NewTestClient()
+	clientConn, err := ssh.Dial("tcp", server.Addr(), client.ClientConfig)
+	require.NoError(t, err)
+	defer clientConn.Close()
+	session, err := clientConn.NewSession()
+	require.NoError(t, err)
+	output, err := session.Output("uptime")
+	require.NoError(t, err)
+	require.Equal(t, "up 1 day\n", string(output))
+}
+
+// fakeTB records logs and cleanups of test
+type fakeTB struct {
+	testing.TB
+	mu       sync.Mutex
+	logs     []string
+	cleanups []func()
+	failed   bool
+}
+
+func (t *fakeTB) Logf(format string, args ...interface{}) {
+	t.mu.Lock()
+	t.logs = append(t.logs, fmt.Sprintf(format, args...))
+	t.mu.Unlock()
+}
+
+func (t *fakeTB) Cleanup(f func()) {
+	t.cleanups = append(t.cleanups, f)
+}
+
+func (t *fakeTB) Errorf(format string, args ...interface{}) {
+	t.Logf(format, args...)
+	t.failed = true
+}
+
+func (t *fakeTB) Failed() bool {
+	return t.failed
+}
+
+func (t *fakeTB) finish(failed bool) {
+	t.failed = t.failed || failed
+	for i := len(t.cleanups) - 1; i >= 0; i-- {
+		t.cleanups[i]()
+	}
+}
+
+func TestNewTestServer_Failed(t *testing.T) {
+	for _, failed := range []bool{false, true} {
+		tb := &fakeTB{TB: t}
+		server := NewTestServer(tb, WithNoClientAuth())
+		require.Len(t, tb.cleanups, 1)
+
+		client := NewTestClient()
+		clientConn, err := ssh.Dial("tcp", server.Addr(), client.ClientConfig)
+		require.NoError(t, err)
+		session, err := clientConn.NewSession()
+		require.NoError(t, err)
+		require.NoError(t, session.Run("whoami"))
+		_ = clientConn.Close()
+
+		tb.finish(failed)
+		logs := strings.Join(tb.logs, "\n")
+		require.Contains(t, logs, "accepted new connection")
+		if failed {
+			require.Contains(t, logs, "served connections:\nconnection from")
+			require.Contains(t, logs, "'exec' &{Command:whoami}")
+		} else {
+			require.NotContains(t, logs, "served connections:")
+		}
+		_, err = ssh.Dial("tcp", server.Addr(), client.ClientConfig)
+		require.Error(t, err)
+	}
+}
+
+func TestNewTestServer_StrictMiss(t *testing.T) {
+	tb := &fakeTB{TB: t}
+	server := NewTestServer(tb, WithNoClientAuth())
+	server.SetExecFallback(ExecFallbackStrict)
+	clientConn, err := server.Dial("admin")
+	require.NoError(t, err)
+	session, err := clientConn.NewSession()
+	require.NoError(t, err)
+	require.Error(t, session.Run("whoami"))
+	_ = clientConn.Close()
+
+	tb.finish(false)
+	require.True(t, tb.failed)
+	logs := strings.Join(tb.logs, "\n")
+	require.Contains(t, logs, "unmocked exec 'whoami'")
+	require.Contains(t, logs, "served connections:")
+}
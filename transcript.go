@@ -0,0 +1,167 @@
+package sshtest
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/craftyhunter/go-sshtest/protocol"
+)
+
+// Direction of transcript event: from client to server or from server to client
+type Direction string
+
+const (
+	DirectionIn  Direction = "in"
+	DirectionOut Direction = "out"
+)
+
+// TranscriptEventType is a kind of channel transcript event
+type TranscriptEventType string
+
+const (
+	TranscriptRequest    TranscriptEventType = "request"
+	TranscriptStdin      TranscriptEventType = "stdin"
+	TranscriptStdout     TranscriptEventType = "stdout"
+	TranscriptStderr     TranscriptEventType = "stderr"
+	TranscriptEOF        TranscriptEventType = "eof"
+	TranscriptClose      TranscriptEventType = "close"
+	TranscriptExitStatus TranscriptEventType = "exit-status"
+	TranscriptExitSignal TranscriptEventType = "exit-signal"
+)
+
+// TranscriptEvent is a single event of channel transcript
+type TranscriptEvent struct {
+	Time      time.Time
+	Direction Direction
+	Type      TranscriptEventType
+
+	// request type and parsed request message for requests, exit-status and exit-signal
+	Name    string
+	Request interface{}
+
+	// data of stdin, stdout and stderr.
+	// Stdin data is limited by StdinOptions in the same way as Channel.Stdin.
+	Data []byte
+	// size of data, can be greater than len(Data) for stdin
+	Size int
+}
+
+func (e TranscriptEvent) String() string {
+	line := fmt.Sprintf("%s %-3s %s", e.Time.Format("15:04:05.000000"), e.Direction, e.Type)
+	switch e.Type {
+	case TranscriptRequest:
+		line += fmt.Sprintf(" '%s' %+v", e.Name, e.Request)
+	case TranscriptExitStatus, TranscriptExitSignal:
+		line += fmt.Sprintf(" %+v", e.Request)
+	case TranscriptStdin, TranscriptStdout, TranscriptStderr:
+		line += fmt.Sprintf(" %d bytes %q", e.Size, e.Data)
+	}
+	return line
+}
+
+func (ch *Channel) record(direction Direction, eventType TranscriptEventType, name string, request interface{}, data []byte, size int) {
+	event := TranscriptEvent{
+		Time:      time.Now(),
+		Direction: direction,
+		Type:      eventType,
+		Name:      name,
+		Request:   request,
+		Size:      size,
+	}
+	if len(data) > 0 {
+		event.Data = append([]byte{}, data...)
+	}
+	ch.mu.Lock()
+	ch.transcript = append(ch.transcript, event)
+	ch.mu.Unlock()
+}
+
+// Transcript returns ordered events of the channel
+func (ch *Channel) Transcript() []TranscriptEvent {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	return append([]TranscriptEvent{}, ch.transcript...)
+}
+
+// DumpTranscript writes channel events in readable form
+func (ch *Channel) DumpTranscript(w io.Writer) {
+	_, _ = fmt.Fprintf(w, "channel '%s'\n", ch.Type)
+	for _, e := range ch.Transcript() {
+		_, _ = fmt.Fprintf(w, "  %s\n", e)
+	}
+}
+
+// DumpTranscript writes events of all channels of the connection in readable form
+func (c *Connection) DumpTranscript(w io.Writer) {
+	_, _ = fmt.Fprintf(w, "connection from %s user '%s'\n", c.RemoteAddr().String(), c.User())
+	for _, ch := range c.ServedChannels() {
+		ch.DumpTranscript(w)
+	}
+}
+
+// DumpTranscript writes events of all served connections in readable form
+func (s *Server) DumpTranscript(w io.Writer) {
+	for _, c := range s.ServedConnections() {
+		c.DumpTranscript(w)
+	}
+}
+
+// TranscriptString returns events of all served connections in readable form
+func (s *Server) TranscriptString() string {
+	b := new(strings.Builder)
+	s.DumpTranscript(b)
+	return b.String()
+}
+
+func (ch *Channel) Write(data []byte) (int, error) {
+	n, err := ch.conn.writeChannelData(data, ch.Channel.Write)
+	if n > 0 {
+		ch.record(DirectionOut, TranscriptStdout, "", nil, data[:n], n)
+	}
+	return n, err
+}
+
+// Stderr returns writer for extended data of the channel
+func (ch *Channel) Stderr() io.ReadWriter {
+	return &stderrRecorder{ReadWriter: ch.Channel.Stderr(), ch: ch}
+}
+
+type stderrRecorder struct {
+	io.ReadWriter
+	ch *Channel
+}
+
+func (s *stderrRecorder) Write(data []byte) (int, error) {
+	n, err := s.ch.conn.writeChannelData(data, s.ReadWriter.Write)
+	if n > 0 {
+		s.ch.record(DirectionOut, TranscriptStderr, "", nil, data[:n], n)
+	}
+	return n, err
+}
+
+// CloseWrite sends EOF to client
+func (ch *Channel) CloseWrite() error {
+	ch.record(DirectionOut, TranscriptEOF, "", nil, nil, 0)
+	return ch.Channel.CloseWrite()
+}
+
+// SendRequest sends channel request to client
+func (ch *Channel) SendRequest(name string, wantReply bool, payload []byte) (bool, error) {
+	switch name {
+	case protocol.MsgTypeExitStatus:
+		msg := new(protocol.MsgExitStatus)
+		_ = ssh.Unmarshal(payload, msg)
+		ch.record(DirectionOut, TranscriptExitStatus, name, msg, nil, 0)
+	case protocol.MsgTypeExitSignal:
+		msg := new(protocol.MsgExitSignal)
+		_ = ssh.Unmarshal(payload, msg)
+		ch.record(DirectionOut, TranscriptExitSignal, name, msg, nil, 0)
+	default:
+		ch.record(DirectionOut, TranscriptRequest, name, protocol.NewUnparsedMsg(name, payload), nil, 0)
+	}
+	return ch.Channel.SendRequest(name, wantReply, payload)
+}
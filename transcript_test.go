@@ -0,0 +1,95 @@
+package sshtest
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/craftyhunter/go-sshtest/protocol"
+)
+
+func TestChannel_Transcript(t *testing.T) {
+	server := NewMockedServer()
+	server.ServerConfig.NoClientAuth = true
+	server.MockExecResult("cat", "OK\n", 0, 3)
+	server.SetFlowControl(FlowControl{ExecWaitEOF: true})
+
+	host, port, err := server.Start()
+	require.NoError(t, err)
+
+	client := NewTestClient()
+	clientConn, err := ssh.Dial("tcp", fmt.Sprintf("%s:%d", host, port), client.ClientConfig)
+	require.NoError(t, err)
+	session, err := clientConn.NewSession()
+	require.NoError(t, err)
+	require.NoError(t, session.Setenv("LANG", "C"))
+	session.Stdin = strings.NewReader("input")
+	_, err = session.Output("cat")
+	require.IsType(t, &ssh.ExitError{}, err)
+	_ = clientConn.Close()
+
+	channel := server.ServedConnections()[0].ServedChannels()[0]
+	transcript := channel.Transcript()
+	var types []TranscriptEventType
+	for _, e := range transcript {
+		types = append(types, e.Type)
+	}
+	require.Equal(t, []TranscriptEventType{
+		TranscriptRequest,
+		TranscriptRequest,
+		TranscriptStdin,
+		TranscriptEOF,
+		TranscriptStdout,
+		TranscriptExitStatus,
+		TranscriptClose,
+	}, types)
+
+	require.Equal(t, DirectionIn, transcript[0].Direction)
+	require.Equal(t, protocol.MsgTypeEnv, transcript[0].Name)
+	require.Equal(t, &protocol.MsgRequestSetEnv{Name: "LANG", Value: "C"}, transcript[0].Request)
+	require.Equal(t, "input", string(transcript[2].Data))
+	require.Equal(t, DirectionOut, transcript[4].Direction)
+	require.Equal(t, "OK\n", string(transcript[4].Data))
+	require.Equal(t, &protocol.MsgExitStatus{ExitStatus: 3}, transcript[5].Request)
+	require.Equal(t, DirectionOut, transcript[6].Direction)
+	for i := 1; i < len(transcript); i++ {
+		require.False(t, transcript[i].Time.Before(transcript[i-1].Time))
+	}
+
+	dump := server.TranscriptString()
+	require.Contains(t, dump, "channel 'session'")
+	require.Contains(t, dump, "in  request 'exec' &{Command:cat}")
+	require.Contains(t, dump, `out stdout 3 bytes "OK\n"`)
+
+	server.Stop()
+	server.Wait()
+}
+
+func TestChannel_TranscriptSubsystemOrder(t *testing.T) {
+	server := NewTestServer(t, WithNoClientAuth())
+	server.MockSubsystem("netconf", ExecResult{Stdout: "<hello/>"})
+
+	for i := 0; i < 20; i++ {
+		clientConn, err := server.Dial("admin")
+		require.NoError(t, err)
+		session, err := clientConn.NewSession()
+		require.NoError(t, err)
+		output, err := session.StdoutPipe()
+		require.NoError(t, err)
+		input, err := session.StdinPipe()
+		require.NoError(t, err)
+		require.NoError(t, session.RequestSubsystem("netconf"))
+		require.NoError(t, input.Close())
+		_, _ = io.ReadAll(output)
+		_ = clientConn.Close()
+	}
+	for _, c := range server.ServedConnections() {
+		transcript := c.ServedChannels()[0].Transcript()
+		require.Equal(t, TranscriptRequest, transcript[0].Type)
+		require.Equal(t, protocol.MsgTypeSubsystem, transcript[0].Name)
+	}
+}
@@ -0,0 +1,96 @@
+package sshtest
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// AddVirtualHost adds host listening on its own address with its own host key, users, mocks and personality.
+// Host is started with the server or immediately if the server is already started, and stopped with the server.
+// Hooks, subscriptions and metrics of the server include all its virtual hosts.
+// New ed25519 key is generated if hostKey is nil. Hosts can't be added to stopped server.
+func (s *Server) AddVirtualHost(listenAddr string, hostKey ssh.Signer, opts ...ServerOption) (*Server, error) {
+	if hostKey == nil {
+		hostKey = NewEd25519Signer()
+	}
+	host := NewServer(listenAddr, hostKey)
+	s.mu.Lock()
+	host.StopTimeout = s.StopTimeout
+	host.logger = s.logger
+	s.mu.Unlock()
+	host.events = s.events
+	host.metrics = s.metrics
+	for _, opt := range opts {
+		opt(host)
+	}
+
+	s.mu.Lock()
+	if s.isStopping() {
+		s.mu.Unlock()
+		return nil, errors.New("server is stopped")
+	}
+	s.virtualHosts = append(s.virtualHosts, host)
+	s.mu.Unlock()
+	if s.started() {
+		if _, _, err := host.Start(); err != nil {
+			s.removeVirtualHost(host)
+			return nil, err
+		}
+		// server could be stopped before host was started
+		s.mu.Lock()
+		stopping := s.isStopping()
+		s.mu.Unlock()
+		if stopping {
+			host.Stop()
+			return nil, errors.New("server is stopped")
+		}
+	}
+	return host, nil
+}
+
+// VirtualHosts returns added virtual hosts
+func (s *Server) VirtualHosts() []*Server {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*Server{}, s.virtualHosts...)
+}
+
+func (s *Server) removeVirtualHost(host *Server) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, h := range s.virtualHosts {
+		if h == host {
+			s.virtualHosts = append(s.virtualHosts[:i], s.virtualHosts[i+1:]...)
+			return
+		}
+	}
+}
+
+// startVirtualHosts starts hosts added before the server is started
+func (s *Server) startVirtualHosts(hosts []*Server) error {
+	for _, host := range hosts {
+		if _, _, err := host.Start(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// shutdownVirtualHosts shuts started hosts down concurrently
+func (s *Server) shutdownVirtualHosts(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, host := range s.VirtualHosts() {
+		if !host.started() {
+			continue
+		}
+		wg.Add(1)
+		go func(host *Server) {
+			defer wg.Done()
+			_ = host.Shutdown(ctx)
+		}(host)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,119 @@
+package sshtest
+
+import (
+	"bytes"
+	"log/slog"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestServer_AddVirtualHost(t *testing.T) {
+	server := NewMockedServer()
+	server.StopTimeout = time.Second
+	first, err := server.AddVirtualHost("127.0.0.1:0", nil, WithUserPassword("admin", "first"))
+	require.NoError(t, err)
+	first.MockExec("hostname", ExecResult{Stdout: "first"})
+	_, _, err = server.Start()
+	require.NoError(t, err)
+	defer server.Stop()
+	second, err := server.AddVirtualHost("127.0.0.1:0", nil, WithUserPassword("admin", "second"))
+	require.NoError(t, err)
+	second.MockExec("hostname", ExecResult{Stdout: "second"})
+	require.Equal(t, []*Server{first, second}, server.VirtualHosts())
+
+	var connects atomic.Int32
+	server.OnConnect(func(c *Connection) error {
+		connects.Add(1)
+		return nil
+	})
+	keys := map[string]string{}
+	for name, host := range map[string]*Server{"first": first, "second": second} {
+		config := &ssh.ClientConfig{
+			User: "admin",
+			Auth: []ssh.AuthMethod{ssh.Password(name)},
+			HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+				require.Equal(t, ssh.KeyAlgoED25519, key.Type())
+				keys[string(key.Marshal())] = name
+				return nil
+			},
+		}
+		clientConn, err := ssh.Dial("tcp", host.Addr(), config)
+		require.NoError(t, err)
+		session, err := clientConn.NewSession()
+		require.NoError(t, err)
+		output, err := session.Output("hostname")
+		require.NoError(t, err)
+		require.Equal(t, name, string(output))
+		_ = clientConn.Close()
+		require.Len(t, host.ServedConnections(), 1)
+	}
+	require.Len(t, keys, 2)
+	require.Equal(t, int32(2), connects.Load())
+	require.Empty(t, server.ServedConnections())
+
+	config := &ssh.ClientConfig{
+		User:            "admin",
+		Auth:            []ssh.AuthMethod{ssh.Password("first")},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	}
+	_, err = ssh.Dial("tcp", second.Addr(), config)
+	require.Error(t, err)
+
+	_, err = server.AddVirtualHost(first.Addr(), nil)
+	require.Error(t, err)
+	require.Len(t, server.VirtualHosts(), 2)
+}
+
+func TestServer_AddVirtualHostStartFailure(t *testing.T) {
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer busy.Close()
+
+	server := NewMockedServer()
+	first, err := server.AddVirtualHost("127.0.0.1:0", nil)
+	require.NoError(t, err)
+	_, err = server.AddVirtualHost(busy.Addr().String(), nil)
+	require.NoError(t, err)
+	_, _, err = server.Start()
+	require.Error(t, err)
+
+	// started listeners are closed
+	_, err = net.Dial("tcp", server.Addr())
+	require.Error(t, err)
+	_, err = net.Dial("tcp", first.Addr())
+	require.Error(t, err)
+
+	_, err = server.AddVirtualHost("127.0.0.1:0", nil)
+	require.EqualError(t, err, "server is stopped")
+	server.Stop()
+}
+
+func TestServer_VirtualHostLogger(t *testing.T) {
+	var buf bytes.Buffer
+	server := NewMockedServer()
+	server.StopTimeout = time.Second
+	WithLogger(slog.New(slog.NewTextHandler(&buf, nil)))(server)
+	// connection served before start reads logger while it is set
+	_ = server.Pipe().Close()
+	_, _, err := server.Start()
+	require.NoError(t, err)
+	defer server.Stop()
+
+	host, err := server.AddVirtualHost("127.0.0.1:0", nil)
+	require.NoError(t, err)
+	server.Stop()
+	var line string
+	for _, l := range strings.Split(buf.String(), "\n") {
+		if strings.Contains(l, "server started") && strings.Contains(l, host.Addr()) {
+			line = l
+		}
+	}
+	require.NotEmpty(t, line)
+	require.Equal(t, 1, strings.Count(line, "server="))
+}
@@ -0,0 +1,76 @@
+package sshtest
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/craftyhunter/go-sshtest/protocol"
+)
+
+// WaitForConnections waits until server accepts at least n connections since start or Reset
+func (s *Server) WaitForConnections(n int, timeout time.Duration) error {
+	check := func() bool {
+		return len(s.ServedConnections()) >= n
+	}
+	if !s.waitFor(check, EventConnect, timeout) {
+		return fmt.Errorf("timeout waiting for %d connections, got %d", n, len(s.ServedConnections()))
+	}
+	return nil
+}
+
+// WaitForExec waits for exec request of command and returns its channel
+func (s *Server) WaitForExec(command string, timeout time.Duration) (*Channel, error) {
+	var found *Channel
+	check := func() bool {
+		found = s.findExec(command)
+		return found != nil
+	}
+	if !s.waitFor(check, EventExec, timeout) {
+		return nil, fmt.Errorf("timeout waiting for exec '%s'", command)
+	}
+	return found, nil
+}
+
+func (s *Server) findExec(command string) *Channel {
+	for _, c := range s.ServedConnections() {
+		for _, ch := range c.ServedChannels() {
+			for _, r := range ch.Requests() {
+				if msg, ok := r.(*protocol.MsgRequestExec); ok && msg.Command == command {
+					return ch
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// waitFor checks condition on each event of eventType until it is true or timeout is expired
+func (s *Server) waitFor(check func() bool, eventType EventType, timeout time.Duration) bool {
+	events, stop := s.Subscribe()
+	defer stop()
+	if check() {
+		return true
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case e := <-events:
+			if e.Type == eventType && check() {
+				return true
+			}
+		case <-timer.C:
+			return check()
+		}
+	}
+}
+
+// WaitClosed waits until connection is closed and handled
+func (c *Connection) WaitClosed(timeout time.Duration) error {
+	select {
+	case <-c.closed:
+		return nil
+	case <-time.After(timeout):
+		return fmt.Errorf("timeout waiting for connection %d to be closed", c.ID)
+	}
+}
@@ -0,0 +1,40 @@
+package sshtest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestServer_Wait(t *testing.T) {
+	server := NewTestServer(t, WithNoClientAuth())
+	client := NewTestClient()
+
+	err := server.WaitForConnections(1, 10*time.Millisecond)
+	require.Error(t, err)
+	require.Equal(t, "timeout waiting for 1 connections, got 0", err.Error())
+
+	clientConn, err := ssh.Dial("tcp", server.Addr(), client.ClientConfig)
+	require.NoError(t, err)
+	require.NoError(t, server.WaitForConnections(1, time.Second))
+
+	go func() {
+		session, err := clientConn.NewSession()
+		if err == nil {
+			_ = session.Run("sleep 1")
+		}
+	}()
+	ch, err := server.WaitForExec("sleep 1", time.Second)
+	require.NoError(t, err)
+	require.Equal(t, 1, ch.ID)
+	_, err = server.WaitForExec("reboot", 10*time.Millisecond)
+	require.Error(t, err)
+
+	c, ok := server.Connection(1)
+	require.True(t, ok)
+	require.Error(t, c.WaitClosed(10*time.Millisecond))
+	_ = clientConn.Close()
+	require.NoError(t, c.WaitClosed(time.Second))
+}